@@ -2,70 +2,397 @@
 package api
 
 import (
+	"bufio"
+	"context"
+	"database/sql"
+	_ "embed"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"strings"
+	"slices"
+	"unicode"
 
+	"github.com/ryepup/amazon-exporter/internal/auth"
+	"github.com/ryepup/amazon-exporter/internal/invoice"
 	"github.com/ryepup/amazon-exporter/internal/models"
+	"github.com/ryepup/amazon-exporter/internal/query"
 )
 
 type Repo interface {
-	Save(models.Order) (bool, error)
+	auth.Store
+
+	Save(context.Context, models.Order) (bool, error)
+	SaveBatch(context.Context, []models.Order) ([]models.SaveResult, error)
+	Load(ctx context.Context, id string) (models.Order, error)
+	Delete(ctx context.Context, id string) error
+	Search(context.Context, query.Query) ([]models.SearchResult, error)
+	Revisions(ctx context.Context, id string) ([]models.Revision, error)
+
+	invoice.Store
+	SaveSnapshot(context.Context, models.InvoiceSnapshot) error
 }
 
-type purchases struct {
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+var errNotFound = newProblem(http.StatusNotFound, "no such order")
+
+//go:generate go tool oapi-codegen --config=config.yaml openapi.json
+
+// spec is the contract for the API. The ServerInterface in server.gen.go is
+// generated from it, so the routes and parameters can't drift from the
+// handlers here.
+//
+//go:embed openapi.json
+var spec []byte
+
+// server implements the generated ServerInterface
+type server struct {
 	repo Repo
 }
 
-func (p *purchases) put(r *http.Request) (int, error) {
+var _ ServerInterface = (*server)(nil)
+
+// ListPurchases searches for orders. "q" is in the search box language,
+// "from" and "to" narrow it down by charge date, and "limit" and "offset" page
+// through the results.
+func (s *server) ListPurchases(w http.ResponseWriter, r *http.Request, params ListPurchasesParams) {
+	var q query.Query
+	if params.Q != nil {
+		var err error
+		if q, err = query.Parse(*params.Q); err != nil {
+			writeError(w, newProblem(http.StatusBadRequest, "q: "+err.Error()))
+			return
+		}
+	}
+	if params.From != nil {
+		q.After = params.From.Time
+	}
+	if params.To != nil {
+		q.Before = params.To.Time
+	}
+	q.Limit, q.Offset = defaultLimit, 0
+	if params.Limit != nil {
+		if *params.Limit < 1 || *params.Limit > maxLimit {
+			writeError(w, newProblem(http.StatusBadRequest, fmt.Sprintf("limit: %d is not between 1 and %d", *params.Limit, maxLimit)))
+			return
+		}
+		q.Limit = *params.Limit
+	}
+	if params.Offset != nil {
+		if *params.Offset < 0 {
+			writeError(w, newProblem(http.StatusBadRequest, fmt.Sprintf("offset: %d is not a non-negative number", *params.Offset)))
+			return
+		}
+		q.Offset = *params.Offset
+	}
+
+	results, err := s.repo.Search(r.Context(), q)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	orders := make([]models.Order, len(results))
+	for i, res := range results {
+		orders[i] = res.Order
+	}
+	writeJSON(w, orders)
+}
+
+func (s *server) GetPurchase(w http.ResponseWriter, r *http.Request, id OrderID) {
+	order, err := s.repo.Load(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = errNotFound
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, order)
+}
+
+func (s *server) PutPurchase(w http.ResponseWriter, r *http.Request, id OrderID) {
 	var request models.Order
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		return 0, err
+		writeError(w, newProblem(http.StatusBadRequest, "invalid order JSON: "+err.Error()))
+		return
 	}
 	// sanity check
-	if !strings.HasSuffix(r.URL.Path, request.ID) {
-		return http.StatusBadRequest, nil
+	if request.ID != id {
+		writeError(w, newProblem(http.StatusBadRequest, fmt.Sprintf("order id %q does not match the URL", request.ID)))
+		return
+	}
+	if err := request.Validate(); err != nil {
+		writeError(w, err)
+		return
 	}
 
-	created, err := p.repo.Save(request)
+	created, err := s.repo.Save(r.Context(), request)
 	if err != nil {
-		return 0, err
+		writeError(w, err)
+		return
 	}
 	if created {
-		return http.StatusCreated, nil
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusOK)
 	}
-	return http.StatusOK, nil
 }
 
-func (p *purchases) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodPut:
-		code, err := p.put(r)
-		if err != nil {
-			log.Println("Error posting purchase:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
+func (s *server) DeletePurchase(w http.ResponseWriter, r *http.Request, id OrderID) {
+	err := s.repo.Delete(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = errNotFound
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListRevisions lists the changes saved for one order
+func (s *server) ListRevisions(w http.ResponseWriter, r *http.Request, id OrderID) {
+	_, err := s.repo.Load(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = errNotFound
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	revs, err := s.repo.Revisions(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, revs)
+}
+
+// maxInvoiceBytes limits how big an invoice upload can be
+const maxInvoiceBytes = 10 << 20
+
+// invoiceUpload is an order's invoice page, along with what the bookmarklet
+// found on the transactions page
+type invoiceUpload struct {
+	Href    string          `json:"href"`
+	Charges []models.Charge `json:"charges"`
+	HTML    string          `json:"html"`
+}
+
+// PutInvoice saves an order by parsing its invoice page, so fixing a scraper
+// when Amazon changes its markup doesn't mean updating the bookmarklet. The
+// page is kept so it can be parsed again by ReparseInvoices.
+func (s *server) PutInvoice(w http.ResponseWriter, r *http.Request, id OrderID) {
+	// no order would ever match a page kept under anything else
+	if !models.ValidOrderID(id) {
+		writeError(w, newProblem(http.StatusBadRequest, fmt.Sprintf("%q is not an order number like 111-1234567-1234567", id)))
+		return
+	}
+
+	var upload invoiceUpload
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxInvoiceBytes)).Decode(&upload); err != nil {
+		writeError(w, newProblem(http.StatusBadRequest, "invalid invoice JSON: "+err.Error()))
+		return
+	}
+
+	// keep the page even if we can't parse it yet, for a later reparse
+	snap := models.InvoiceSnapshot{OrderID: id, Href: upload.Href, Charges: upload.Charges, HTML: upload.HTML}
+	if err := s.repo.SaveSnapshot(r.Context(), snap); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	order, inv, err := invoice.FromSnapshot(snap)
+	var invalid models.ValidationError
+	if errors.As(err, &invalid) {
+		writeError(w, invalid)
+		return
+	} else if err != nil {
+		writeError(w, newProblem(http.StatusUnprocessableEntity, err.Error()))
+		return
+	}
+
+	created, err := s.repo.SaveInvoice(r.Context(), order)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if created {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+	}
+	writeJSON(w, inv)
+}
+
+// maxBatchBytes limits how big a batch upload can be
+const maxBatchBytes = 64 << 20
+
+// batchResult reports what happened to one order of a batch
+type batchResult struct {
+	ID     string              `json:"id"`
+	Status string              `json:"status"` // created, updated or error
+	Error  string              `json:"error,omitempty"`
+	Errors []models.FieldError `json:"errors,omitempty"`
+}
+
+// BatchPurchases saves many orders at once, sent either as a JSON array or as
+// newline-delimited JSON with one order per line.
+func (s *server) BatchPurchases(w http.ResponseWriter, r *http.Request) {
+	orders, err := decodeOrders(http.MaxBytesReader(w, r.Body, maxBatchBytes))
+	if err != nil {
+		writeError(w, newProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	// only valid orders go to the store, the rest are reported in place
+	results := make([]batchResult, len(orders))
+	valid := make([]models.Order, 0, len(orders))
+	validIdx := make([]int, 0, len(orders))
+	for i, o := range orders {
+		var invalid models.ValidationError
+		if errors.As(o.Validate(), &invalid) {
+			results[i] = batchResult{ID: o.ID, Status: "error", Error: invalid.Error(), Errors: invalid}
+			continue
 		}
-		w.WriteHeader(code)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		valid = append(valid, o)
+		validIdx = append(validIdx, i)
+	}
+
+	saved, err := s.repo.SaveBatch(r.Context(), valid)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	for j, res := range saved {
+		results[validIdx[j]] = newBatchResult(res)
 	}
+	writeJSON(w, results)
 }
 
-func New(repo Repo) http.Handler {
+func newBatchResult(res models.SaveResult) batchResult {
+	result := batchResult{ID: res.ID, Status: "updated"}
+	var invalid models.ValidationError
+	switch {
+	case errors.As(res.Err, &invalid):
+		result.Status = "error"
+		result.Error = invalid.Error()
+		result.Errors = invalid
+	case res.Err != nil:
+		result.Status = "error"
+		result.Error = res.Err.Error()
+	case res.Created:
+		result.Status = "created"
+	}
+	return result
+}
+
+// ReparseInvoices runs the current invoice parsers over the newest saved
+// invoice page of every order, after fixing a parser.
+func (s *server) ReparseInvoices(w http.ResponseWriter, r *http.Request) {
+	saved, err := invoice.Reparse(r.Context(), s.repo)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	results := make([]batchResult, len(saved))
+	for i, res := range saved {
+		results[i] = newBatchResult(res)
+	}
+	writeJSON(w, results)
+}
+
+// decodeOrders reads a JSON array of orders, or a stream of orders one after
+// another as in NDJSON. The whole body is read before anything is saved, so
+// malformed input doesn't leave a half-imported batch.
+func decodeOrders(body io.Reader) ([]models.Order, error) {
+	br := bufio.NewReader(body)
+	dec := json.NewDecoder(br)
+	orders := []models.Order{}
+
+	// peek past whitespace to tell an array from a stream
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			return orders, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if !unicode.IsSpace(rune(c)) {
+			br.UnreadByte()
+			if c == '[' {
+				if err := dec.Decode(&orders); err != nil {
+					return nil, fmt.Errorf("invalid order array: %w", err)
+				}
+				return orders, nil
+			}
+			break
+		}
+	}
+
+	for {
+		var o models.Order
+		err := dec.Decode(&o)
+		if err == io.EOF {
+			return orders, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid order #%d: %w", len(orders)+1, err)
+		}
+		orders = append(orders, o)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Error writing response:", err)
+	}
+}
+
+type Config struct {
+	// AllowedOrigins are the sites whose pages may call the API, like
+	// https://www.amazon.com for the bookmarklet
+	AllowedOrigins []string
+}
+
+// New serves the API described by openapi.json. Every request except CORS
+// preflights and the spec itself needs an API token made on the UI settings
+// page.
+func New(repo Repo, cfg Config) http.Handler {
+	routes := HandlerWithOptions(&server{repo}, StdHTTPServerOptions{
+		ErrorHandlerFunc: func(w http.ResponseWriter, r *http.Request, err error) {
+			writeError(w, newProblem(http.StatusBadRequest, err.Error()))
+		},
+	})
+
+	// the spec is public, so clients can be generated without a token
 	mux := http.NewServeMux()
-	mux.Handle("/purchases/", &purchases{repo})
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	})
+	mux.Handle("/", auth.RequireToken(repo, writeError, routes))
 
-	return withCORS(mux)
+	return withCORS(cfg.AllowedOrigins, mux)
 }
 
-func withCORS(next http.Handler) http.Handler {
+// withCORS lets the allowed origins call the API from the browser. Preflight
+// requests are answered here, since browsers don't send credentials with them.
+func withCORS(origins []string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		h := w.Header()
-		h.Add("Access-Control-Allow-Origin", "*")
-		h.Add("Access-Control-Allow-Methods", "POST, PUT, GET, OPTIONS")
-		h.Add("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+		h.Add("Vary", "Origin")
+		if origin := r.Header.Get("Origin"); origin != "" && slices.Contains(origins, origin) {
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Allow-Methods", "POST, PUT, GET, DELETE, OPTIONS")
+			h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept")
+		}
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
@@ -0,0 +1,441 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ryepup/amazon-exporter/internal/auth"
+	"github.com/ryepup/amazon-exporter/internal/models"
+	"github.com/ryepup/amazon-exporter/internal/store"
+	_ "modernc.org/sqlite"
+)
+
+// testAPI serves the API over a fresh store, and returns a valid token for it
+func testAPI(t *testing.T) (http.Handler, *store.Store, string) {
+	t.Helper()
+	s, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	token, hash, err := auth.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateToken(context.Background(), "test", hash); err != nil {
+		t.Fatal(err)
+	}
+	return New(s, Config{}), s, token
+}
+
+func do(t *testing.T, h http.Handler, token, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func orderJSON(t *testing.T, o models.Order) string {
+	t.Helper()
+	b, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestDecodeOrders(t *testing.T) {
+	one := `{"id":"111-0000000-0000001","items":["Coffee"],"price":1,"charges":[]}`
+	two := `{"id":"111-0000000-0000002","items":["Tea"],"price":2,"charges":[]}`
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "array", body: "[" + one + "," + two + "]", want: []string{"111-0000000-0000001", "111-0000000-0000002"}},
+		{name: "array after whitespace", body: "\n\t [" + one + "]", want: []string{"111-0000000-0000001"}},
+		{name: "empty array", body: "[]", want: []string{}},
+		{name: "NDJSON", body: one + "\n" + two + "\n", want: []string{"111-0000000-0000001", "111-0000000-0000002"}},
+		{name: "NDJSON with blank lines", body: "\n" + one + "\n\n" + two, want: []string{"111-0000000-0000001", "111-0000000-0000002"}},
+		{name: "one order", body: one, want: []string{"111-0000000-0000001"}},
+		{name: "empty", body: "", want: []string{}},
+		{name: "only whitespace", body: " \n ", want: []string{}},
+		{name: "bad array", body: "[" + one + ",", wantErr: true},
+		{name: "bad line", body: one + "\n{\"id\":", wantErr: true},
+		{name: "not an order", body: `"111-0000000-0000001"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orders, err := decodeOrders(strings.NewReader(tt.body))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("decodeOrders() = %+v, want an error", orders)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(orders))
+			for i, o := range orders {
+				got[i] = o.ID
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeOrders() IDs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchPurchases(t *testing.T) {
+	order := func(id string) models.Order {
+		return models.Order{
+			ID:      id,
+			Items:   []models.Item{{Title: "Coffee", Quantity: 1, UnitPrice: 17260}},
+			Price:   17260,
+			Charges: []models.Charge{{Card: "Visa ****1234", Amount: -17260, Date: "January 3, 2024"}},
+		}
+	}
+	invalid := order("111-0000000-0000002")
+	invalid.Items = nil
+	orders := []models.Order{order("111-0000000-0000001"), invalid, order("111-0000000-0000003")}
+
+	lines := make([]string, len(orders))
+	for i, o := range orders {
+		lines[i] = orderJSON(t, o)
+	}
+	bodies := map[string]string{
+		"array":  "[" + strings.Join(lines, ",") + "]",
+		"NDJSON": strings.Join(lines, "\n") + "\n",
+	}
+	for name, body := range bodies {
+		t.Run(name, func(t *testing.T) {
+			h, s, token := testAPI(t)
+			w := do(t, h, token, http.MethodPost, "/purchases:batch", body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var results []batchResult
+			if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+				t.Fatal(err)
+			}
+			var statuses []string
+			for _, res := range results {
+				statuses = append(statuses, res.ID+" "+res.Status)
+			}
+			want := []string{"111-0000000-0000001 created", "111-0000000-0000002 error", "111-0000000-0000003 created"}
+			if !reflect.DeepEqual(statuses, want) {
+				t.Errorf("results = %v, want %v", statuses, want)
+			}
+			if len(results) == 3 && (len(results[1].Errors) != 1 || results[1].Errors[0].Field != "items") {
+				t.Errorf("invalid order errors = %+v, want one for items", results[1].Errors)
+			}
+
+			ctx := context.Background()
+			for _, id := range []string{"111-0000000-0000001", "111-0000000-0000003"} {
+				if _, err := s.Load(ctx, id); err != nil {
+					t.Errorf("Load(%s) error = %v", id, err)
+				}
+			}
+			if _, err := s.Load(ctx, "111-0000000-0000002"); err == nil {
+				t.Error("the invalid order was saved")
+			}
+
+			// sending it again updates rather than creates
+			w = do(t, h, token, http.MethodPost, "/purchases:batch", body)
+			if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 3 || results[0].Status != "updated" {
+				t.Errorf("second batch = %+v, want the first order updated", results)
+			}
+		})
+	}
+
+	t.Run("malformed", func(t *testing.T) {
+		h, s, token := testAPI(t)
+		body := lines[0] + "\n{\"id\":"
+		w := do(t, h, token, http.MethodPost, "/purchases:batch", body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		if _, err := s.Load(context.Background(), "111-0000000-0000001"); err == nil {
+			t.Error("saved part of a malformed batch")
+		}
+	})
+}
+
+func TestCORS(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	h := New(s, Config{AllowedOrigins: []string{"https://www.amazon.com"}})
+
+	tests := []struct {
+		name       string
+		method     string
+		origin     string
+		wantStatus int
+		wantAllow  string
+	}{
+		{"preflight from an allowed origin", http.MethodOptions, "https://www.amazon.com", http.StatusNoContent, "https://www.amazon.com"},
+		{"preflight from another origin", http.MethodOptions, "https://evil.example", http.StatusNoContent, ""},
+		{"preflight from a lookalike origin", http.MethodOptions, "https://www.amazon.com.evil.example", http.StatusNoContent, ""},
+		{"allowed origin still needs a token", http.MethodGet, "https://www.amazon.com", http.StatusUnauthorized, "https://www.amazon.com"},
+		{"another origin", http.MethodGet, "https://evil.example", http.StatusUnauthorized, ""},
+		{"no origin", http.MethodGet, "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/purchases", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == http.MethodOptions {
+				r.Header.Set("Access-Control-Request-Method", http.MethodPut)
+				r.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllow {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantAllow)
+			}
+			allowHeaders := w.Header().Get("Access-Control-Allow-Headers")
+			if tt.wantAllow != "" && !strings.Contains(allowHeaders, "Authorization") {
+				t.Errorf("Access-Control-Allow-Headers = %q, want Authorization allowed", allowHeaders)
+			} else if tt.wantAllow == "" && allowHeaders != "" {
+				t.Errorf("Access-Control-Allow-Headers = %q for a disallowed origin", allowHeaders)
+			}
+			if got := w.Header().Get("Vary"); got != "Origin" {
+				t.Errorf("Vary = %q, want Origin", got)
+			}
+		})
+	}
+}
+
+func TestTokens(t *testing.T) {
+	ctx := context.Background()
+	h, s, token := testAPI(t)
+
+	if w := do(t, h, token, http.MethodGet, "/purchases", ""); w.Code != http.StatusOK {
+		t.Errorf("status with a valid token = %d, body %s", w.Code, w.Body)
+	}
+	w := do(t, h, "nope", http.MethodGet, "/purchases", "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status with a wrong token = %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type with a wrong token = %q", ct)
+	}
+	// the spec is public
+	if w := do(t, h, "", http.MethodGet, "/openapi.json", ""); w.Code != http.StatusOK {
+		t.Errorf("status for the spec without a token = %d", w.Code)
+	}
+
+	tokens, err := s.Tokens(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range tokens {
+		if err := s.DeleteToken(ctx, tok.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w := do(t, h, token, http.MethodGet, "/purchases", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("status with a revoked token = %d", w.Code)
+	}
+}
+
+func TestPutInvoiceRejectsBadIDs(t *testing.T) {
+	ctx := context.Background()
+	h, s, token := testAPI(t)
+	body := `{"href":"https://example.com","charges":[],"html":"<html></html>"}`
+
+	for _, id := range []string{"not-an-order", "111-1234567", "111-1234567-1234567x"} {
+		w := do(t, h, token, http.MethodPut, "/purchases/"+id+"/invoice", body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("PUT invoice for %q: status = %d, want %d", id, w.Code, http.StatusBadRequest)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("PUT invoice for %q: Content-Type = %q", id, ct)
+		}
+	}
+	snaps, err := s.LatestSnapshots(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 0 {
+		t.Errorf("kept %d snapshots for bad order IDs", len(snaps))
+	}
+
+	// a page we can't parse yet is still kept for a good ID
+	w := do(t, h, token, http.MethodPut, "/purchases/111-1234567-1234567/invoice", body)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+	if snaps, err := s.LatestSnapshots(ctx); err != nil || len(snaps) != 1 {
+		t.Errorf("snapshots = %v, %v, want the one page kept", snaps, err)
+	}
+}
+
+func TestListPurchasesRejectsBadPaging(t *testing.T) {
+	h, _, token := testAPI(t)
+	for _, params := range []string{"limit=0", "limit=-1", "limit=1001", "limit=5000", "offset=-1"} {
+		w := do(t, h, token, http.MethodGet, "/purchases?"+params, "")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET with %s: status = %d, want %d", params, w.Code, http.StatusBadRequest)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("GET with %s: Content-Type = %q", params, ct)
+		}
+	}
+	for _, params := range []string{"limit=1", "limit=1000", "offset=0"} {
+		if w := do(t, h, token, http.MethodGet, "/purchases?"+params, ""); w.Code != http.StatusOK {
+			t.Errorf("GET with %s: status = %d, body %s", params, w.Code, w.Body)
+		}
+	}
+}
+
+// purchaseAPI serves the API over three saved orders, newest first
+func purchaseAPI(t *testing.T) (http.Handler, string) {
+	t.Helper()
+	h, s, token := testAPI(t)
+	orders := []models.Order{
+		{
+			ID:      "111-0000000-0000001",
+			Items:   []models.Item{{Title: "Ground Coffee", Quantity: 1, UnitPrice: 17260}},
+			Price:   17260,
+			Charges: []models.Charge{{Card: "Visa ****1234", Amount: -17260, Date: "March 5, 2024"}},
+		},
+		{
+			ID:      "111-0000000-0000002",
+			Items:   []models.Item{{Title: "Paper Towels", Quantity: 1, UnitPrice: 9990}},
+			Price:   9990,
+			Charges: []models.Charge{{Card: "Visa ****1234", Amount: -9990, Date: "February 1, 2024"}},
+		},
+		{
+			ID:      "111-0000000-0000003",
+			Items:   []models.Item{{Title: "Coffee Filters", Quantity: 1, UnitPrice: 4990}},
+			Price:   4990,
+			Charges: []models.Charge{{Card: "Visa ****1234", Amount: -4990, Date: "January 10, 2024"}},
+		},
+	}
+	for _, o := range orders {
+		if _, err := s.Save(context.Background(), o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return h, token
+}
+
+func TestGetPurchase(t *testing.T) {
+	h, token := purchaseAPI(t)
+
+	w := do(t, h, token, http.MethodGet, "/purchases/111-0000000-0000002", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var got models.Order
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "111-0000000-0000002" || len(got.Items) != 1 || got.Items[0].Title != "Paper Towels" || got.Price != 9990 {
+		t.Errorf("order = %+v", got)
+	}
+
+	w = do(t, h, token, http.MethodGet, "/purchases/111-0000000-0000009", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status for a missing order = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type for a missing order = %q", ct)
+	}
+}
+
+func TestListPurchases(t *testing.T) {
+	h, token := purchaseAPI(t)
+	tests := []struct {
+		params string
+		want   []string
+	}{
+		{"", []string{"111-0000000-0000001", "111-0000000-0000002", "111-0000000-0000003"}},
+		{"q=coffee", []string{"111-0000000-0000001", "111-0000000-0000003"}},
+		{"q=towels", []string{"111-0000000-0000002"}},
+		{"q=tea", nil},
+		{"from=2024-02-01", []string{"111-0000000-0000001", "111-0000000-0000002"}},
+		{"to=2024-02-01", []string{"111-0000000-0000002", "111-0000000-0000003"}},
+		{"from=2024-01-11&to=2024-03-04", []string{"111-0000000-0000002"}},
+		{"q=coffee&from=2024-02-01", []string{"111-0000000-0000001"}},
+		{"limit=2", []string{"111-0000000-0000001", "111-0000000-0000002"}},
+		{"limit=2&offset=2", []string{"111-0000000-0000003"}},
+		{"offset=3", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.params, func(t *testing.T) {
+			w := do(t, h, token, http.MethodGet, "/purchases?"+tt.params, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var orders []models.Order
+			if err := json.NewDecoder(w.Body).Decode(&orders); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, o := range orders {
+				got = append(got, o.ID)
+			}
+			// without search terms, newest first; otherwise by relevance
+			if strings.Contains(tt.params, "q=") {
+				slices.Sort(got)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GET /purchases?%s = %v, want %v", tt.params, got, tt.want)
+			}
+		})
+	}
+
+	if w := do(t, h, token, http.MethodGet, "/purchases?from=yesterday", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("status for a bad date = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestDeletePurchase(t *testing.T) {
+	h, token := purchaseAPI(t)
+
+	if w := do(t, h, token, http.MethodDelete, "/purchases/111-0000000-0000002", ""); w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d, body %s", w.Code, http.StatusNoContent, w.Body)
+	}
+	if w := do(t, h, token, http.MethodGet, "/purchases/111-0000000-0000002", ""); w.Code != http.StatusNotFound {
+		t.Errorf("status getting a deleted order = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	w := do(t, h, token, http.MethodDelete, "/purchases/111-0000000-0000002", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status deleting it again = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type deleting it again = %q", ct)
+	}
+	// the others are still there
+	if w := do(t, h, token, http.MethodGet, "/purchases/111-0000000-0000001", ""); w.Code != http.StatusOK {
+		t.Errorf("status getting another order = %d", w.Code)
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/ryepup/amazon-exporter/internal/auth"
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// problem is an RFC 7807 problem details response. It's also an error, so
+// handlers can return one and let writeError send it.
+type problem struct {
+	Type   string `json:"type,omitempty"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Errors lists the fields that failed validation
+	Errors []models.FieldError `json:"errors,omitempty"`
+}
+
+func (p *problem) Error() string { return p.Detail }
+
+func newProblem(status int, detail string) *problem {
+	return &problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// invalidOrder describes why an order failed models.Order.Validate
+func invalidOrder(err models.ValidationError) *problem {
+	p := newProblem(http.StatusUnprocessableEntity, "the order failed validation")
+	p.Errors = err
+	return p
+}
+
+// writeError sends err as problem+json. Errors that aren't already a problem
+// are logged and reported as a 500 without details.
+func writeError(w http.ResponseWriter, err error) {
+	var p *problem
+	var invalid models.ValidationError
+	switch {
+	case errors.As(err, &p):
+	case errors.As(err, &invalid):
+		p = invalidOrder(invalid)
+	case errors.Is(err, auth.ErrUnauthorized):
+		p = newProblem(http.StatusUnauthorized, err.Error())
+	default:
+		log.Println("api error:", err)
+		p = newProblem(http.StatusInternalServerError, "")
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		log.Println("Error writing problem:", err)
+	}
+}
@@ -0,0 +1,103 @@
+// Package auth guards the API with bearer tokens and the UI with login
+// sessions. Tokens and session IDs are random secrets; only their hashes are
+// stored.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// SessionCookie is the name of the cookie holding the UI session
+const SessionCookie = "session"
+
+type Store interface {
+	TokenValid(ctx context.Context, hash string) (bool, error)
+	SessionValid(ctx context.Context, hash string) (bool, error)
+}
+
+// NewSecret makes a random token or session ID, and the hash to store for it.
+func NewSecret() (secret, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret = base64.RawURLEncoding.EncodeToString(b)
+	return secret, Hash(secret), nil
+}
+
+// Hash is how secrets are stored
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// PasswordMatches compares passwords in constant time
+func PasswordMatches(got, want string) bool {
+	g, w := sha256.Sum256([]byte(got)), sha256.Sum256([]byte(want))
+	return subtle.ConstantTimeCompare(g[:], w[:]) == 1
+}
+
+// ErrUnauthorized is what RequireToken reports for a missing or invalid token
+var ErrUnauthorized = errors.New("a valid bearer token is required")
+
+// RequireToken rejects requests without a valid "Authorization: Bearer"
+// token. Rejections are written by fail, with ErrUnauthorized once the
+// WWW-Authenticate header is set, or with the store's error.
+func RequireToken(s Store, fail func(http.ResponseWriter, error), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			fail(w, ErrUnauthorized)
+			return
+		}
+		valid, err := s.TokenValid(r.Context(), Hash(token))
+		if err != nil {
+			fail(w, fmt.Errorf("checking token: %w", err))
+			return
+		}
+		if !valid {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			fail(w, ErrUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireSession redirects requests without a valid session cookie to
+// loginPath. Requests for loginPath and the public paths are let through.
+func RequireSession(s Store, loginPath string, public []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == loginPath || slices.Contains(public, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if c, err := r.Cookie(SessionCookie); err == nil {
+			valid, err := s.SessionValid(r.Context(), Hash(c.Value))
+			if err != nil {
+				log.Println("Error checking session:", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if valid {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		http.Redirect(w, r, loginPath, http.StatusFound)
+	})
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeStore knows a set of valid token and session hashes
+type fakeStore struct {
+	tokens, sessions map[string]bool
+	err              error
+}
+
+func (s fakeStore) TokenValid(_ context.Context, hash string) (bool, error) {
+	return s.tokens[hash], s.err
+}
+
+func (s fakeStore) SessionValid(_ context.Context, hash string) (bool, error) {
+	return s.sessions[hash], s.err
+}
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusTeapot)
+})
+
+func TestRequireToken(t *testing.T) {
+	token, hash, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, _, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := fakeStore{tokens: map[string]bool{hash: true}}
+	fail := func(w http.ResponseWriter, err error) {
+		if errors.Is(err, ErrUnauthorized) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		store         Store
+		want          int
+		challenge     string
+	}{
+		{"valid", "Bearer " + token, store, http.StatusTeapot, ""},
+		{"missing", "", store, http.StatusUnauthorized, "Bearer"},
+		{"empty", "Bearer ", store, http.StatusUnauthorized, "Bearer"},
+		{"not bearer", "Basic " + token, store, http.StatusUnauthorized, "Bearer"},
+		{"the hash instead of the token", "Bearer " + hash, store, http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"wrong", "Bearer nope", store, http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"revoked", "Bearer " + revoked, store, http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"store fails", "Bearer " + token, fakeStore{err: errors.New("disk on fire")}, http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/purchases", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			RequireToken(tt.store, fail, ok).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.challenge)
+			}
+		})
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	session, hash, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := fakeStore{sessions: map[string]bool{hash: true}}
+
+	tests := []struct {
+		name   string
+		path   string
+		cookie string
+		store  Store
+		want   int
+	}{
+		{"valid session", "/ynab", session, store, http.StatusTeapot},
+		{"no session", "/ynab", "", store, http.StatusFound},
+		{"expired session", "/ynab", "expired", store, http.StatusFound},
+		{"the hash instead of the session", "/ynab", hash, store, http.StatusFound},
+		{"login page", "/login", "", store, http.StatusTeapot},
+		{"public path", "/static/export.js", "", store, http.StatusTeapot},
+		{"only exact public paths", "/static/other.js", "", store, http.StatusFound},
+		{"store fails", "/ynab", session, fakeStore{err: errors.New("disk on fire")}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: SessionCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			RequireSession(tt.store, "/login", []string{"/static/export.js"}, ok).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if w.Code == http.StatusFound {
+				if got := w.Header().Get("Location"); got != "/login" {
+					t.Errorf("redirected to %q, want /login", got)
+				}
+			}
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	a, hashA, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("two secrets are the same")
+	}
+	if hashA != Hash(a) || hashA == a {
+		t.Errorf("hash = %q, want Hash of the secret", hashA)
+	}
+}
+
+func TestPasswordMatches(t *testing.T) {
+	if !PasswordMatches("hunter2", "hunter2") {
+		t.Error("same password doesn't match")
+	}
+	for _, got := range []string{"", "hunter", "hunter22", "Hunter2"} {
+		if PasswordMatches(got, "hunter2") {
+			t.Errorf("%q matches hunter2", got)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Package autoapprove picks the YNAB transactions that are safe to approve
+// without anyone looking at them: ones that clearly paid for a single order,
+// where a rule or what's been learned from past approvals says what the
+// category is.
+package autoapprove
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ryepup/amazon-exporter/internal/classify"
+	"github.com/ryepup/amazon-exporter/internal/match"
+	"github.com/ryepup/amazon-exporter/internal/models"
+	"github.com/ryepup/amazon-exporter/internal/rules"
+)
+
+// Config sets how sure we have to be
+type Config struct {
+	// MinScore is the match score the order needs, see match.Candidate.
+	// Zero turns auto-approval off.
+	MinScore float64
+	// MinConfidence is how sure a learned category has to be, when no rule
+	// picks one
+	MinConfidence float64
+	// MinExamples and MinCategories are how much has to have been learned
+	// before a learned category is trusted. At least two categories are
+	// needed either way: with only one, it's always 100% sure.
+	MinExamples, MinCategories int
+}
+
+func (c Config) Enabled() bool { return c.MinScore > 0 }
+
+// trusts reports whether enough has been learned to go by how sure the
+// classifier is
+func (c Config) trusts(classifier *classify.Model) bool {
+	return classifier.Examples() >= c.MinExamples && classifier.Categories() >= max(c.MinCategories, 2)
+}
+
+// Decide picks the transactions to approve out of the match results. A
+// transaction qualifies if the matcher proposed an order for it without any
+// doubt, no other order scores above MinScore, and either a rule or a
+// confident suggestion from a classifier that's learned enough gives its
+// category.
+func (c Config) Decide(budgetID models.BudgetID, results []match.Result, rs []*rules.Rule, classifier *classify.Model) []models.AutoApproval {
+	if !c.Enabled() {
+		return nil
+	}
+	learned := c.trusts(classifier)
+	var approvals []models.AutoApproval
+	for _, res := range results {
+		if res.Proposed < 0 || res.Ambiguous {
+			continue
+		}
+		var above int
+		for _, candidate := range res.Candidates {
+			if candidate.Score >= c.MinScore {
+				above++
+			}
+		}
+		proposed := res.Candidates[res.Proposed]
+		if above != 1 || proposed.Score < c.MinScore {
+			continue
+		}
+
+		t := res.Transaction
+		a := models.AutoApproval{
+			BudgetID:    budgetID,
+			Transaction: t,
+			OrderID:     proposed.ID,
+			Payee:       t.Payee,
+			Score:       proposed.Score,
+			ApprovedAt:  time.Now(),
+		}
+		if rule, _ := rules.Suggest(rs, t, []models.OrderCharge{proposed.OrderCharge}); rule != nil {
+			a.CategoryID, a.CategoryName = rule.CategoryID, rule.CategoryName
+			if rule.PayeeName != "" {
+				a.Payee = rule.PayeeName
+			}
+			a.Reason = fmt.Sprintf("rule %d", rule.ID)
+		} else if s := classifier.Rank(proposed.Items); learned && len(s) > 0 && s[0].Confidence >= c.MinConfidence {
+			a.CategoryID, a.CategoryName = s[0].ID, s[0].Name
+			a.Reason = fmt.Sprintf("learned, %.0f%% sure", s[0].Confidence*100)
+		} else {
+			continue
+		}
+		approvals = append(approvals, a)
+	}
+	return approvals
+}
@@ -0,0 +1,187 @@
+package autoapprove
+
+import (
+	"testing"
+
+	"github.com/ryepup/amazon-exporter/internal/classify"
+	"github.com/ryepup/amazon-exporter/internal/match"
+	"github.com/ryepup/amazon-exporter/internal/models"
+	"github.com/ryepup/amazon-exporter/internal/rules"
+)
+
+var (
+	groceries = models.Category{ID: "c-groceries", Name: "Groceries"}
+	household = models.Category{ID: "c-household", Name: "Household"}
+	gifts     = models.Category{ID: "c-gifts", Name: "Gifts"}
+)
+
+// result is a match for one order with the given item titles, proposed with
+// the given score
+func result(score float64, titles ...string) match.Result {
+	var items []models.Item
+	for _, title := range titles {
+		items = append(items, models.Item{Title: title, Quantity: 1})
+	}
+	return match.Result{
+		Transaction: models.UnapprovedTransaction{ID: "t1", Amount: -19990, Payee: "Amazon"},
+		Candidates: []match.Candidate{{
+			OrderCharge: models.OrderCharge{Order: models.Order{ID: "o1", Items: items}},
+			Score:       score,
+			Proposed:    true,
+		}},
+	}
+}
+
+// model learns n examples of each title in each category
+func model(n int, examples map[models.Category][]string) *classify.Model {
+	m := classify.NewModel()
+	for c, titles := range examples {
+		for _, title := range titles {
+			for range n {
+				m.Learn(classify.Example{Category: c, Title: title})
+			}
+		}
+	}
+	return m
+}
+
+func TestDecide(t *testing.T) {
+	config := Config{MinScore: 0.9, MinConfidence: 0.8, MinExamples: 20, MinCategories: 3}
+	trained := model(10, map[models.Category][]string{
+		groceries: {"Coffee Beans, Whole"},
+		household: {"Dish Soap"},
+		gifts:     {"Gift Card"},
+	})
+	soap, err := rules.Compile(models.Rule{ID: 7, TitlePattern: "soap", CategoryID: household.ID, CategoryName: household.Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		config     Config
+		result     match.Result
+		rules      []*rules.Rule
+		classifier *classify.Model
+		// want is the category approved with, "" for none
+		want models.CategoryID
+	}{
+		{
+			name:       "learned",
+			result:     result(1, "Coffee Beans"),
+			classifier: trained,
+			want:       groceries.ID,
+		},
+		{
+			name:       "rule",
+			result:     result(1, "Dish Soap"),
+			rules:      []*rules.Rule{soap},
+			classifier: classify.NewModel(),
+			want:       household.ID,
+		},
+		{
+			name:   "rule without enough learned",
+			result: result(1, "Dish Soap"),
+			rules:  []*rules.Rule{soap},
+			classifier: model(1, map[models.Category][]string{
+				groceries: {"Coffee"},
+			}),
+			want: household.ID,
+		},
+		{
+			name:   "one learned example",
+			result: result(1, "Coffee beans", "Gift card"),
+			classifier: model(1, map[models.Category][]string{
+				groceries: {"Coffee"},
+			}),
+		},
+		{
+			name:   "plenty learned in one category",
+			config: Config{MinScore: 0.9, MinConfidence: 0.8},
+			result: result(1, "Coffee beans", "Gift card"),
+			classifier: model(50, map[models.Category][]string{
+				groceries: {"Coffee"},
+			}),
+		},
+		{
+			name:   "too few examples",
+			result: result(1, "Coffee Beans"),
+			classifier: model(1, map[models.Category][]string{
+				groceries: {"Coffee Beans, Whole"},
+				household: {"Dish Soap"},
+				gifts:     {"Gift Card"},
+			}),
+		},
+		{
+			name:   "too few categories",
+			result: result(1, "Coffee Beans"),
+			classifier: model(20, map[models.Category][]string{
+				groceries: {"Coffee Beans, Whole"},
+				household: {"Dish Soap"},
+			}),
+		},
+		{
+			name:       "not sure enough",
+			result:     result(1, "Coffee Beans", "Gift Card"),
+			classifier: trained,
+		},
+		{
+			name:       "low score",
+			result:     result(0.8, "Coffee Beans"),
+			classifier: trained,
+		},
+		{
+			name: "ambiguous",
+			result: func() match.Result {
+				res := result(1, "Coffee Beans")
+				res.Ambiguous = true
+				return res
+			}(),
+			classifier: trained,
+		},
+		{
+			name: "another order scores as well",
+			result: func() match.Result {
+				res := result(1, "Coffee Beans")
+				res.Candidates = append(res.Candidates, match.Candidate{
+					OrderCharge: models.OrderCharge{Order: models.Order{ID: "o2"}},
+					Score:       0.95,
+				})
+				return res
+			}(),
+			classifier: trained,
+		},
+		{
+			name: "nothing proposed",
+			result: func() match.Result {
+				res := result(1, "Coffee Beans")
+				res.Proposed = -1
+				return res
+			}(),
+			classifier: trained,
+		},
+		{
+			name:       "turned off",
+			config:     Config{MinConfidence: 0.8},
+			result:     result(1, "Coffee Beans"),
+			classifier: trained,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config
+			if tt.config != (Config{}) {
+				c = tt.config
+			}
+			approvals := c.Decide("b", []match.Result{tt.result}, tt.rules, tt.classifier)
+			var got models.CategoryID
+			if len(approvals) > 0 {
+				got = approvals[0].CategoryID
+			}
+			if got != tt.want {
+				t.Errorf("approved with %q, want %q (%+v)", got, tt.want, approvals)
+			}
+		})
+	}
+}
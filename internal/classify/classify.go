@@ -0,0 +1,171 @@
+// Package classify suggests YNAB categories for orders, learned from how
+// orders were categorized before. It's a naive Bayes classifier over the
+// words in item titles: each item approved into a category is an example of
+// that category.
+package classify
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// Example is an item title that was approved into a category
+type Example struct {
+	Category models.Category
+	Title    string
+}
+
+// stopWords are too common in item titles to say anything about the category
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "for": true, "in": true, "of": true,
+	"on": true, "or": true, "the": true, "to": true, "with": true, "by": true,
+	"pack": true, "count": true, "ct": true, "oz": true, "inch": true,
+}
+
+// Tokens are the distinct words of an item title worth learning from:
+// lowercase, without numbers, stop words or single letters.
+func Tokens(title string) []string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var tokens []string
+	for _, w := range words {
+		if len(w) < 2 || stopWords[w] || strings.IndexFunc(w, unicode.IsLetter) < 0 {
+			continue
+		}
+		if !slices.Contains(tokens, w) {
+			tokens = append(tokens, w)
+		}
+	}
+	return tokens
+}
+
+// Model is what's been learned for one budget
+type Model struct {
+	names    map[models.CategoryID]string
+	examples map[models.CategoryID]int
+	tokens   map[models.CategoryID]map[string]int
+	// totals are the number of tokens seen per category
+	totals map[models.CategoryID]int
+	vocab  map[string]bool
+}
+
+func NewModel() *Model {
+	return &Model{
+		names:    map[models.CategoryID]string{},
+		examples: map[models.CategoryID]int{},
+		tokens:   map[models.CategoryID]map[string]int{},
+		totals:   map[models.CategoryID]int{},
+		vocab:    map[string]bool{},
+	}
+}
+
+// AddExamples records that n examples were learned for c
+func (m *Model) AddExamples(c models.Category, n int) {
+	m.names[c.ID] = c.Name
+	m.examples[c.ID] += n
+}
+
+// AddToken records that token was seen n times in examples of c
+func (m *Model) AddToken(c models.CategoryID, token string, n int) {
+	if m.tokens[c] == nil {
+		m.tokens[c] = map[string]int{}
+	}
+	m.tokens[c][token] += n
+	m.totals[c] += n
+	m.vocab[token] = true
+}
+
+// Learn adds an example to the model
+func (m *Model) Learn(e Example) {
+	m.AddExamples(e.Category, 1)
+	for _, t := range Tokens(e.Title) {
+		m.AddToken(e.Category.ID, t, 1)
+	}
+}
+
+// Examples is how many examples have been learned
+func (m *Model) Examples() int {
+	var total int
+	for _, n := range m.examples {
+		total += n
+	}
+	return total
+}
+
+// Categories is how many categories have examples
+func (m *Model) Categories() int {
+	var n int
+	for _, e := range m.examples {
+		if e > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Suggestion is a category an order probably belongs in
+type Suggestion struct {
+	models.Category
+	// Confidence is the probability of the category, between 0 and 1
+	Confidence float64
+}
+
+// Rank scores every category the model knows for an order with the given
+// items, most likely first. It returns nil if none of the item titles have
+// words the model has seen.
+func (m *Model) Rank(items []models.Item) []Suggestion {
+	var tokens []string
+	for _, item := range items {
+		for _, t := range Tokens(item.Title) {
+			if m.vocab[t] {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	total := m.Examples()
+	vocab := float64(len(m.vocab))
+	suggestions := make([]Suggestion, 0, len(m.examples))
+	scores := make([]float64, 0, len(m.examples))
+	for c, n := range m.examples {
+		if n == 0 {
+			continue
+		}
+		// log P(c) + sum of log P(token|c), with add-one smoothing
+		score := math.Log(float64(n) / float64(total))
+		for _, t := range tokens {
+			score += math.Log(float64(m.tokens[c][t]+1) / (float64(m.totals[c]) + vocab))
+		}
+		suggestions = append(suggestions, Suggestion{Category: models.Category{ID: c, Name: m.names[c]}})
+		scores = append(scores, score)
+	}
+
+	if len(scores) == 0 {
+		return nil
+	}
+
+	// softmax the log scores into probabilities, shifted by the max so the
+	// exponents don't underflow
+	top := slices.Max(scores)
+	var sum float64
+	for i, s := range scores {
+		suggestions[i].Confidence = math.Exp(s - top)
+		sum += suggestions[i].Confidence
+	}
+	for i := range suggestions {
+		suggestions[i].Confidence /= sum
+	}
+	slices.SortFunc(suggestions, func(a, b Suggestion) int {
+		return cmp.Or(cmp.Compare(b.Confidence, a.Confidence), cmp.Compare(a.Name, b.Name))
+	})
+	return suggestions
+}
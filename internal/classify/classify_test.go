@@ -0,0 +1,151 @@
+package classify
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+var (
+	groceries = models.Category{ID: "c-groceries", Name: "Groceries"}
+	household = models.Category{ID: "c-household", Name: "Household"}
+)
+
+func items(titles ...string) []models.Item {
+	var items []models.Item
+	for _, title := range titles {
+		items = append(items, models.Item{Title: title, Quantity: 1})
+	}
+	return items
+}
+
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		title string
+		want  []string
+	}{
+		{"", nil},
+		{"Coffee", []string{"coffee"}},
+		{"Ground Coffee, Medium Roast", []string{"ground", "coffee", "medium", "roast"}},
+		{"coffee COFFEE Coffee", []string{"coffee"}},
+		{"Paper Towels, 6 Pack of 12 Rolls", []string{"paper", "towels", "rolls"}},
+		{"AA Batteries (24-Count) for the Remote", []string{"aa", "batteries", "remote"}},
+		{"Tea, 12oz", []string{"tea", "12oz"}},
+		{"USB-C Cable x 2", []string{"usb", "cable"}},
+		{"Café Crème", []string{"café", "crème"}},
+	}
+	for _, tt := range tests {
+		if got := Tokens(tt.title); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokens(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestRankUnknown(t *testing.T) {
+	if got := NewModel().Rank(items("Coffee")); got != nil {
+		t.Errorf("empty model Rank() = %+v, want nil", got)
+	}
+
+	m := NewModel()
+	m.Learn(Example{Category: groceries, Title: "Coffee Beans"})
+	tests := map[string][]models.Item{
+		"no items":       nil,
+		"unseen words":   items("Dish Soap"),
+		"only numbers":   items("12 34"),
+		"only stopwords": items("a pack of the"),
+	}
+	for name, items := range tests {
+		if got := m.Rank(items); got != nil {
+			t.Errorf("%s: Rank() = %+v, want nil", name, got)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	m := NewModel()
+	m.Learn(Example{Category: groceries, Title: "Coffee Beans"})
+	m.Learn(Example{Category: household, Title: "Dish Soap"})
+
+	// one example each, four words seen: P(coffee|groceries) is
+	// (1+1)/(2+4), P(coffee|household) is (0+1)/(2+4)
+	assertRank(t, m.Rank(items("Coffee")), []string{"Groceries", "Household"}, []float64{2.0 / 3, 1.0 / 3})
+
+	// words the model hasn't seen don't count
+	assertRank(t, m.Rank(items("Coffee", "Gift Card")), []string{"Groceries", "Household"}, []float64{2.0 / 3, 1.0 / 3})
+
+	// a word for each, so tied, and then by name
+	assertRank(t, m.Rank(items("Coffee Soap")), []string{"Groceries", "Household"}, []float64{0.5, 0.5})
+}
+
+func TestRankAfterMoreTraining(t *testing.T) {
+	m := NewModel()
+	m.Learn(Example{Category: groceries, Title: "Coffee Beans"})
+	m.Learn(Example{Category: household, Title: "Dish Soap"})
+	if got := m.Rank(items("Coffee")); got[0].ID != groceries.ID {
+		t.Fatalf("Rank() = %+v, want groceries first", got)
+	}
+
+	// coffee filters keep getting filed under household
+	m.Learn(Example{Category: household, Title: "Coffee Filters"})
+	m.Learn(Example{Category: household, Title: "Coffee Filters"})
+
+	// household: 3 of 4 examples, coffee 2 of its 6 words; groceries: 1 of
+	// 4, coffee 1 of 2; 5 words seen
+	h := 3.0 / 4 * (2 + 1) / (6 + 5)
+	g := 1.0 / 4 * (1 + 1) / (2 + 5)
+	assertRank(t, m.Rank(items("Coffee")), []string{"Household", "Groceries"}, []float64{h / (h + g), g / (h + g)})
+}
+
+func TestRankOneCategory(t *testing.T) {
+	m := NewModel()
+	m.Learn(Example{Category: groceries, Title: "Coffee"})
+	assertRank(t, m.Rank(items("Coffee beans", "Gift card")), []string{"Groceries"}, []float64{1})
+	if m.Examples() != 1 || m.Categories() != 1 {
+		t.Errorf("Examples(), Categories() = %d, %d, want 1, 1", m.Examples(), m.Categories())
+	}
+}
+
+// TestLoaded checks a model loaded from counts, the way the store does, ranks
+// the same as one that learned the examples
+func TestLoaded(t *testing.T) {
+	learned := NewModel()
+	learned.Learn(Example{Category: groceries, Title: "Coffee Beans"})
+	learned.Learn(Example{Category: groceries, Title: "Coffee"})
+	learned.Learn(Example{Category: household, Title: "Dish Soap"})
+
+	loaded := NewModel()
+	loaded.AddExamples(groceries, 2)
+	loaded.AddToken(groceries.ID, "coffee", 2)
+	loaded.AddToken(groceries.ID, "beans", 1)
+	loaded.AddExamples(household, 1)
+	loaded.AddToken(household.ID, "dish", 1)
+	loaded.AddToken(household.ID, "soap", 1)
+
+	for _, title := range []string{"Coffee", "Soap", "Coffee Soap"} {
+		if a, b := learned.Rank(items(title)), loaded.Rank(items(title)); !reflect.DeepEqual(a, b) {
+			t.Errorf("%s: learned %+v, loaded %+v", title, a, b)
+		}
+	}
+	if loaded.Examples() != 3 || loaded.Categories() != 2 {
+		t.Errorf("Examples(), Categories() = %d, %d, want 3, 2", loaded.Examples(), loaded.Categories())
+	}
+}
+
+func assertRank(t *testing.T, got []Suggestion, names []string, confidences []float64) {
+	t.Helper()
+	if len(got) != len(names) {
+		t.Fatalf("Rank() = %+v, want %v", got, names)
+	}
+	var sum float64
+	for i, s := range got {
+		if s.Name != names[i] || math.Abs(s.Confidence-confidences[i]) > 1e-9 {
+			t.Errorf("Rank()[%d] = %s %v, want %s %v", i, s.Name, s.Confidence, names[i], confidences[i])
+		}
+		sum += s.Confidence
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("confidences add up to %v", sum)
+	}
+}
@@ -0,0 +1,116 @@
+package invoice
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// findAll returns the elements under n that match, in document order
+func findAll(n *html.Node, match func(*html.Node) bool) []*html.Node {
+	var found []*html.Node
+	for d := range n.Descendants() {
+		if d.Type == html.ElementNode && match(d) {
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+// find returns the first element under n that matches, or nil
+func find(n *html.Node, match func(*html.Node) bool) *html.Node {
+	for d := range n.Descendants() {
+		if d.Type == html.ElementNode && match(d) {
+			return d
+		}
+	}
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(class string) func(*html.Node) bool {
+	return func(n *html.Node) bool {
+		return strings.Contains(" "+attr(n, "class")+" ", " "+class+" ")
+	}
+}
+
+func isTag(a atom.Atom) func(*html.Node) bool {
+	return func(n *html.Node) bool { return n.DataAtom == a }
+}
+
+// component matches the data-component attributes on newer invoices
+func component(name string) func(*html.Node) bool {
+	return func(n *html.Node) bool { return attr(n, "data-component") == name }
+}
+
+// closest returns n or its nearest ancestor that matches, or nil
+func closest(n *html.Node, match func(*html.Node) bool) *html.Node {
+	for ; n != nil; n = n.Parent {
+		if n.Type == html.ElementNode && match(n) {
+			return n
+		}
+	}
+	return nil
+}
+
+// blocks are the elements that start a new line of text
+var blocks = map[atom.Atom]bool{
+	atom.Br: true, atom.Div: true, atom.P: true, atom.Tr: true, atom.Li: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true,
+	atom.Table: true, atom.Tbody: true, atom.Ul: true, atom.Ol: true,
+}
+
+// text is roughly the innerText of n: one line per block element, with runs
+// of whitespace collapsed. Table cells are separated by a space.
+func text(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			sb.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if n.DataAtom == atom.Script || n.DataAtom == atom.Style {
+				return
+			}
+		}
+		block := blocks[n.DataAtom]
+		if block {
+			sb.WriteByte('\n')
+		}
+		for c := range n.ChildNodes() {
+			walk(c)
+		}
+		switch {
+		case block:
+			sb.WriteByte('\n')
+		case n.DataAtom == atom.Td || n.DataAtom == atom.Th:
+			sb.WriteByte(' ')
+		}
+	}
+	walk(n)
+
+	var lines []string
+	for line := range strings.SplitSeq(sb.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rowText is the text of n on one line, for rows where the label and value
+// are in separate elements
+func rowText(n *html.Node) string {
+	return strings.ReplaceAll(text(n), "\n", " ")
+}
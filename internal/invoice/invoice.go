@@ -0,0 +1,207 @@
+// Package invoice reads the orders out of Amazon invoice pages. Amazon has
+// changed the invoice markup over the years, and shows digital orders
+// differently, so each layout has its own parser and Parse picks the first
+// one that recognizes the page. When Amazon changes the markup again, add a
+// new Layout in layouts.go and register it ahead of the one it replaces.
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrUnknownLayout means none of the layouts recognized the page
+var ErrUnknownLayout = errors.New("not an invoice layout we know")
+
+// Invoice is what an invoice page says about an order
+type Invoice struct {
+	// Layout is the name of the layout that parsed the page
+	Layout   string          `json:"layout"`
+	OrderID  string          `json:"orderId"`
+	Items    []models.Item   `json:"items"`
+	Subtotal models.Money    `json:"subtotal"`
+	Shipping models.Money    `json:"shipping"`
+	Tax      models.Money    `json:"tax"`
+	Total    models.Money    `json:"total"`
+	Charges  []models.Charge `json:"charges"`
+}
+
+// Layout is one version of Amazon's invoice markup
+type Layout struct {
+	Name string
+	// Matches reports whether the page looks like this layout
+	Matches func(doc *html.Node) bool
+	Parse   func(doc *html.Node) (Invoice, error)
+}
+
+// layouts are tried in the order they were registered, so more specific
+// layouts should come first
+var layouts []Layout
+
+func register(l Layout) {
+	if slices.ContainsFunc(layouts, func(o Layout) bool { return o.Name == l.Name }) {
+		panic("invoice: layout registered twice: " + l.Name)
+	}
+	layouts = append(layouts, l)
+}
+
+func init() {
+	register(digital)
+	register(modern)
+	register(classic)
+}
+
+// Layouts lists the names of the layouts Parse knows
+func Layouts() []string {
+	names := make([]string, len(layouts))
+	for i, l := range layouts {
+		names[i] = l.Name
+	}
+	return names
+}
+
+// Parse reads an invoice page with the first layout that matches it.
+func Parse(r io.Reader) (Invoice, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return Invoice{}, fmt.Errorf("invalid invoice HTML: %w", err)
+	}
+	for _, l := range layouts {
+		if !l.Matches(doc) {
+			continue
+		}
+		inv, err := l.Parse(doc)
+		if err != nil {
+			return Invoice{}, fmt.Errorf("%s invoice: %w", l.Name, err)
+		}
+		inv.Layout = l.Name
+		if inv.OrderID == "" {
+			inv.OrderID = findOrderID(doc)
+		}
+		if inv.Charges == nil {
+			inv.Charges = findCharges(doc)
+		}
+		// with only one item, its price is the subtotal
+		if len(inv.Items) == 1 && inv.Items[0].UnitPrice == 0 && inv.Items[0].Quantity == 1 {
+			inv.Items[0].UnitPrice = inv.Subtotal
+		}
+		return inv, nil
+	}
+	return Invoice{}, ErrUnknownLayout
+}
+
+// Apply fills in the parts of an order that the invoice knows about. Charges
+// on the invoice are added to any o already has, like the ones scraped from
+// the transactions page, skipping the ones it has already, see
+// models.Charge.Same. Identical charges are counted, so two same-day
+// shipments of the same amount both stay.
+func (inv Invoice) Apply(o models.Order) models.Order {
+	o.Items = inv.Items
+	o.Price = inv.Total
+	known := slices.Clone(o.Charges)
+	for _, c := range inv.Charges {
+		if i := slices.IndexFunc(known, c.Same); i >= 0 {
+			known = slices.Delete(known, i, i+1)
+		} else {
+			o.Charges = append(o.Charges, c)
+		}
+	}
+	return o
+}
+
+// asinPattern finds the ASIN in product links like /dp/B000000000
+var asinPattern = regexp.MustCompile(`/(?:dp|gp/product)/([A-Z0-9]{10})`)
+
+// productLink fills in the item's URL and ASIN from a link to its product page
+func productLink(item *models.Item, a *html.Node) {
+	href := attr(a, "href")
+	if href == "" {
+		return
+	}
+	if strings.HasPrefix(href, "/") {
+		href = "https://www.amazon.com" + href
+	}
+	item.URL = href
+	if m := asinPattern.FindStringSubmatch(href); m != nil {
+		item.ASIN = m[1]
+	}
+}
+
+var orderIDPattern = regexp.MustCompile(`\b(\d{3}|D\d{2})-\d{7}-\d{7}\b`)
+
+func findOrderID(doc *html.Node) string {
+	return orderIDPattern.FindString(text(doc))
+}
+
+// chargePattern matches the rows of the "Credit Card transactions" section,
+// like "Visa ending in 1234: January 2, 2024: $12.34". The invoice shows
+// charges as positive and refunds as negative, the other way around from the
+// transactions page.
+var chargePattern = regexp.MustCompile(`^([^:]+ ending in \d{4}): ([A-Z][a-z]+ \d{1,2}, \d{4}): (-?\$[\d,]+\.\d{2})$`)
+
+func findCharges(doc *html.Node) []models.Charge {
+	var (
+		charges []models.Charge
+		rows    []*html.Node
+	)
+	for _, row := range findAll(doc, func(n *html.Node) bool { return n.DataAtom == atom.Tr || n.DataAtom == atom.Div }) {
+		m := chargePattern.FindStringSubmatch(rowText(row))
+		if m == nil {
+			continue
+		}
+		amount, err := models.ParseMoney(m[3])
+		if err != nil {
+			continue
+		}
+		c := models.Charge{Card: m[1], Amount: -amount, Date: m[2]}
+		// wrapper elements match too, and come first; the innermost row
+		// is the charge. Two separate rows can be identical charges.
+		if i := slices.IndexFunc(rows, func(wrapper *html.Node) bool {
+			return closest(row, func(n *html.Node) bool { return n == wrapper }) != nil
+		}); i >= 0 {
+			rows[i], charges[i] = row, c
+			continue
+		}
+		rows = append(rows, row)
+		charges = append(charges, c)
+	}
+	return charges
+}
+
+// summary reads the order summary rows, like "Item(s) Subtotal: $12.34", into
+// the invoice. It reports whether it found a grand total.
+func summary(inv *Invoice, rows []*html.Node) bool {
+	var foundTotal bool
+	for _, row := range rows {
+		label, value, ok := strings.Cut(rowText(row), ":")
+		if !ok {
+			continue
+		}
+		amount, err := models.ParseMoney(value)
+		if err != nil {
+			continue
+		}
+		switch label = strings.ToLower(label); {
+		case strings.Contains(label, "subtotal"):
+			inv.Subtotal = amount
+		case strings.Contains(label, "shipping"):
+			// promotions like "Free Shipping: -$5.99" cancel out the charge
+			inv.Shipping += amount
+		case strings.Contains(label, "before tax"):
+		case strings.Contains(label, "tax"):
+			inv.Tax += amount
+		case strings.Contains(label, "grand total"), strings.Contains(label, "order total"):
+			inv.Total = amount
+			foundTotal = true
+		}
+	}
+	return foundTotal
+}
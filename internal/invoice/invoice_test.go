@@ -0,0 +1,227 @@
+package invoice
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+func fixture(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    Invoice
+		err     error
+	}{
+		{
+			fixture: "modern.html",
+			want: Invoice{
+				Layout:  "modern",
+				OrderID: "112-0000000-0000001",
+				Items: []models.Item{
+					{
+						Title:     "Ground Coffee, Medium Roast, 12 Ounce",
+						ASIN:      "B000000001",
+						URL:       "https://www.amazon.com/dp/B000000001?ref=ppx_pop",
+						Quantity:  2,
+						UnitPrice: 11990,
+						Seller:    "Example Roasters LLC",
+					},
+					{
+						Title:     "Dish Soap, Lemon, 3 Pack",
+						ASIN:      "B000000002",
+						URL:       "https://www.amazon.com/gp/product/B000000002",
+						Quantity:  1,
+						UnitPrice: 6500,
+						Seller:    "Amazon.com Services, Inc",
+					},
+				},
+				Subtotal: 30480,
+				Tax:      4040,
+				Total:    34520,
+				// two shipments billed the same amount on the same day
+				Charges: []models.Charge{
+					{Card: "Visa ending in 1234", Amount: -17260, Date: "January 3, 2024"},
+					{Card: "Visa ending in 1234", Amount: -17260, Date: "January 3, 2024"},
+				},
+			},
+		},
+		{
+			fixture: "classic.html",
+			want: Invoice{
+				Layout:  "classic",
+				OrderID: "113-0000000-0000002",
+				Items: []models.Item{
+					{
+						Title:     "Paper Towels, 6 Double Rolls",
+						ASIN:      "B000000003",
+						URL:       "https://www.amazon.com/gp/product/B000000003",
+						Quantity:  2,
+						UnitPrice: 9990,
+						Seller:    "Amazon.com Services, Inc",
+					},
+					{
+						Title:     "Tea Bags, Green, 100 Count",
+						Quantity:  1,
+						UnitPrice: 4200,
+						Seller:    "Example Tea Co.",
+					},
+				},
+				Subtotal: 24180,
+				Tax:      1970,
+				Total:    26150,
+				Charges: []models.Charge{
+					{Card: "Mastercard ending in 5678", Amount: -26150, Date: "February 11, 2024"},
+				},
+			},
+		},
+		{
+			fixture: "digital.html",
+			want: Invoice{
+				Layout:  "digital",
+				OrderID: "D01-0000000-0000003",
+				Items: []models.Item{
+					{
+						Title:    "The Example Novel: A Story (Kindle Edition)",
+						ASIN:     "B000000004",
+						URL:      "https://www.amazon.com/dp/B000000004",
+						Quantity: 1,
+						// the only item, so it's the subtotal
+						UnitPrice: 4990,
+					},
+				},
+				Subtotal: 4990,
+				Tax:      350,
+				Total:    5340,
+				Charges: []models.Charge{
+					{Card: "Visa ending in 1234", Amount: -5340, Date: "March 5, 2024"},
+				},
+			},
+		},
+		{
+			fixture: "unknown.html",
+			err:     ErrUnknownLayout,
+		},
+	}
+
+	// every registered layout needs a fixture
+	for _, name := range Layouts() {
+		if _, err := os.Stat(filepath.Join("testdata", name+".html")); err != nil {
+			t.Errorf("layout %s has no fixture: %v", name, err)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			got, err := Parse(f)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromSnapshot(t *testing.T) {
+	charge := models.Charge{Card: "Visa ending in 1234", Amount: -17260, Date: "January 3, 2024"}
+	// the transactions page writes the card its own way
+	scraped := models.Charge{Card: "Visa ****1234", Amount: -17260, Date: "January 3, 2024"}
+	modern := fixture(t, "modern.html")
+
+	tests := []struct {
+		name    string
+		snap    models.InvoiceSnapshot
+		charges []models.Charge
+		wantErr func(error) bool
+	}{
+		{
+			name:    "adds the charges the transactions page missed",
+			snap:    models.InvoiceSnapshot{OrderID: "112-0000000-0000001", HTML: modern, Charges: []models.Charge{charge}},
+			charges: []models.Charge{charge, charge},
+		},
+		{
+			name:    "doesn't repeat charges it already has",
+			snap:    models.InvoiceSnapshot{OrderID: "112-0000000-0000001", HTML: modern, Charges: []models.Charge{charge, charge}},
+			charges: []models.Charge{charge, charge},
+		},
+		{
+			name:    "card written differently on the transactions page",
+			snap:    models.InvoiceSnapshot{OrderID: "112-0000000-0000001", HTML: modern, Charges: []models.Charge{scraped}},
+			charges: []models.Charge{scraped, charge},
+		},
+		{
+			name:    "all the charges, with the card written differently",
+			snap:    models.InvoiceSnapshot{OrderID: "112-0000000-0000001", HTML: modern, Charges: []models.Charge{scraped, scraped}},
+			charges: []models.Charge{scraped, scraped},
+		},
+		{
+			name:    "without charges from the transactions page",
+			snap:    models.InvoiceSnapshot{OrderID: "112-0000000-0000001", HTML: modern},
+			charges: []models.Charge{charge, charge},
+		},
+		{
+			name:    "for another order",
+			snap:    models.InvoiceSnapshot{OrderID: "112-9999999-9999999", HTML: modern},
+			wantErr: func(err error) bool { return err != nil },
+		},
+		{
+			name:    "unknown layout",
+			snap:    models.InvoiceSnapshot{OrderID: "112-0000000-0000001", HTML: fixture(t, "unknown.html")},
+			wantErr: func(err error) bool { return errors.Is(err, ErrUnknownLayout) },
+		},
+		{
+			name: "invalid charge from the transactions page",
+			snap: models.InvoiceSnapshot{OrderID: "112-0000000-0000001", HTML: modern, Charges: []models.Charge{
+				{Card: "Visa ending in 1234", Amount: -17260, Date: "yesterday"},
+			}},
+			wantErr: func(err error) bool {
+				var invalid models.ValidationError
+				return errors.As(err, &invalid)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, _, err := FromSnapshot(tt.snap)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Fatalf("FromSnapshot() error = %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FromSnapshot() error = %v", err)
+			}
+			if order.ID != tt.snap.OrderID || order.Price != 34520 || len(order.Items) != 2 {
+				t.Errorf("FromSnapshot() = %+v", order)
+			}
+			if !reflect.DeepEqual(order.Charges, tt.charges) {
+				t.Errorf("FromSnapshot() charges = %v, want %v", order.Charges, tt.charges)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package invoice
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	errNoItems = errors.New("no items found")
+	errNoTotal = errors.New("no order total found")
+)
+
+// modern is the print.html invoice Amazon has used since 2023, marked up with
+// data-component attributes.
+var modern = Layout{
+	Name: "modern",
+	Matches: func(doc *html.Node) bool {
+		return find(doc, component("itemTitle")) != nil
+	},
+	Parse: func(doc *html.Node) (Invoice, error) {
+		var inv Invoice
+		for _, title := range findAll(doc, component("itemTitle")) {
+			inv.Items = append(inv.Items, modernItem(title))
+		}
+		if len(inv.Items) == 0 {
+			return inv, errNoItems
+		}
+		if !summary(&inv, findAll(doc, hasClass("od-line-item-row"))) {
+			return inv, errNoTotal
+		}
+		return inv, nil
+	},
+}
+
+// modernItem reads an item from the box around its title
+func modernItem(title *html.Node) models.Item {
+	item := models.Item{Title: text(title), Quantity: 1}
+	if a := find(title, isTag(atom.A)); a != nil {
+		productLink(&item, a)
+	}
+
+	// the smallest box with a price, as long as it's only for this item
+	var box *html.Node
+	for n := title.Parent; n != nil; n = n.Parent {
+		if len(findAll(n, component("itemTitle"))) > 1 {
+			break
+		}
+		if find(n, component("unitPrice")) != nil {
+			box = n
+			break
+		}
+	}
+	if box == nil {
+		return item
+	}
+	if price, err := models.ParseMoney(text(find(box, component("unitPrice")))); err == nil {
+		item.UnitPrice = price
+	}
+	if seller := find(box, component("orderedMerchant")); seller != nil {
+		item.Seller = strings.TrimSpace(strings.TrimPrefix(text(seller), "Sold by:"))
+	}
+	if qty := find(box, hasClass("od-item-view-qty")); qty != nil {
+		if n, err := strconv.Atoi(text(qty)); err == nil && n > 0 {
+			item.Quantity = n
+		}
+	}
+	return item
+}
+
+// classic is the older table-based print.html invoice, which Subscribe and
+// Save orders still use.
+var classic = Layout{
+	Name: "classic",
+	Matches: func(doc *html.Node) bool {
+		return len(itemsOrdered(doc)) > 0
+	},
+	Parse: func(doc *html.Node) (Invoice, error) {
+		var inv Invoice
+		for _, heading := range itemsOrdered(doc) {
+			table := closest(heading, isTag(atom.Tbody))
+			if table == nil {
+				continue
+			}
+			for _, title := range findAll(table, func(n *html.Node) bool {
+				return n.DataAtom == atom.I && closest(n, isTag(atom.Td)) != nil
+			}) {
+				inv.Items = append(inv.Items, classicItem(title))
+			}
+		}
+		if len(inv.Items) == 0 {
+			return inv, errNoItems
+		}
+		if summary(&inv, findAll(doc, isTag(atom.Tr))) {
+			return inv, nil
+		}
+		// some only have the "Order Total: $12.34" heading
+		for _, b := range findAll(doc, isTag(atom.B)) {
+			if t, ok := strings.CutPrefix(text(b), "Order Total:"); ok {
+				total, err := models.ParseMoney(t)
+				if err != nil {
+					return inv, err
+				}
+				inv.Total = total
+				return inv, nil
+			}
+		}
+		return inv, errNoTotal
+	},
+}
+
+var (
+	quantityPattern = regexp.MustCompile(`^(\d+) of:`)
+	sellerPattern   = regexp.MustCompile(`^Sold by: (.+?)(?: \(seller profile\))?$`)
+)
+
+// classicItem reads an item from its table cell, like "2 of: <i>Paper
+// towels</i><br>Sold by: Amazon.com Services, Inc", and the price in the next
+// cell.
+func classicItem(title *html.Node) models.Item {
+	item := models.Item{Title: text(title), Quantity: 1}
+	if a := find(title, isTag(atom.A)); a != nil {
+		productLink(&item, a)
+	}
+	td := closest(title, isTag(atom.Td))
+	for line := range strings.SplitSeq(text(td), "\n") {
+		if m := quantityPattern.FindStringSubmatch(line); m != nil {
+			item.Quantity, _ = strconv.Atoi(m[1])
+		}
+		if m := sellerPattern.FindStringSubmatch(line); m != nil {
+			item.Seller = m[1]
+		}
+	}
+	for next := td.NextSibling; next != nil; next = next.NextSibling {
+		if next.DataAtom == atom.Td {
+			if price, err := models.ParseMoney(text(next)); err == nil {
+				item.UnitPrice = price
+			}
+			break
+		}
+	}
+	return item
+}
+
+// itemsOrdered finds the "Items Ordered" headings of the classic layout. There's
+// one per shipment.
+func itemsOrdered(doc *html.Node) []*html.Node {
+	return findAll(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.B && text(n) == "Items Ordered"
+	})
+}
+
+// digital is the invoice for Kindle books, apps and other digital orders,
+// which have order numbers starting with D.
+var digital = Layout{
+	Name: "digital",
+	Matches: func(doc *html.Node) bool {
+		return strings.HasPrefix(findOrderID(doc), "D")
+	},
+	Parse: func(doc *html.Node) (Invoice, error) {
+		var inv Invoice
+		for _, title := range findAll(doc, func(n *html.Node) bool {
+			if n.DataAtom != atom.A || n.Parent == nil || n.Parent.DataAtom != atom.B {
+				return component("itemTitle")(n)
+			}
+			td := closest(n, isTag(atom.Td))
+			return td != nil && attr(td, "valign") == "top"
+		}) {
+			item := models.Item{Title: text(title), Quantity: 1}
+			if a := closest(title, isTag(atom.A)); a != nil {
+				productLink(&item, a)
+			} else if a := find(title, isTag(atom.A)); a != nil {
+				productLink(&item, a)
+			}
+			inv.Items = append(inv.Items, item)
+		}
+		if len(inv.Items) == 0 {
+			return inv, errNoItems
+		}
+
+		rows := append(findAll(doc, isTag(atom.Tr)), findAll(doc, hasClass("od-line-item-row"))...)
+		if summary(&inv, rows) {
+			return inv, nil
+		}
+		total := find(doc, hasClass("a-color-price"))
+		if total == nil {
+			if charges := find(doc, component("chargeSummary")); charges != nil {
+				if amounts := findAll(charges, hasClass("a-span-last")); len(amounts) > 0 {
+					total = amounts[len(amounts)-1]
+				}
+			}
+		}
+		if total == nil {
+			return inv, errNoTotal
+		}
+		var err error
+		inv.Total, err = models.ParseMoney(text(total))
+		return inv, err
+	},
+}
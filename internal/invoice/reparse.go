@@ -0,0 +1,56 @@
+package invoice
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// Store is where Reparse finds invoice snapshots and saves the orders in them
+type Store interface {
+	LatestSnapshots(context.Context) ([]int64, error)
+	Snapshot(ctx context.Context, id int64) (models.InvoiceSnapshot, error)
+	SaveInvoice(context.Context, models.Order) (bool, error)
+}
+
+// FromSnapshot parses an uploaded invoice page into the order it's for,
+// returning a models.ValidationError if the result isn't worth saving.
+func FromSnapshot(snap models.InvoiceSnapshot) (models.Order, Invoice, error) {
+	inv, err := Parse(strings.NewReader(snap.HTML))
+	if err != nil {
+		return models.Order{}, inv, err
+	}
+	if inv.OrderID != "" && inv.OrderID != snap.OrderID {
+		return models.Order{}, inv, fmt.Errorf("invoice is for order %q, not %q", inv.OrderID, snap.OrderID)
+	}
+
+	order := inv.Apply(models.Order{ID: snap.OrderID, Href: snap.Href, Charges: snap.Charges})
+	return order, inv, order.Validate()
+}
+
+// Reparse runs the current parsers over the newest snapshot of every order and
+// saves the results. Each order succeeds or fails on its own; the returned
+// error is only for problems loading the snapshots.
+func Reparse(ctx context.Context, s Store) ([]models.SaveResult, error) {
+	ids, err := s.LatestSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]models.SaveResult, 0, len(ids))
+	for _, id := range ids {
+		snap, err := s.Snapshot(ctx, id)
+		if err != nil {
+			return results, err
+		}
+		res := models.SaveResult{ID: snap.OrderID}
+		var order models.Order
+		if order, _, res.Err = FromSnapshot(snap); res.Err == nil {
+			res.Created, res.Err = s.SaveInvoice(ctx, order)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
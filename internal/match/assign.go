@@ -0,0 +1,162 @@
+package match
+
+import "math"
+
+// scale turns scores into integer costs, so equal scores tie exactly
+const scale = 1_000_000
+
+// noMatch is the cost of a pair that isn't a candidate at all
+const noMatch = math.MaxInt64 / 4
+
+// assign proposes at most one candidate per transaction, and each charge for
+// at most one transaction, picking the set of pairs with the best total score.
+// Transactions can go without a proposal rather than take a charge that fits
+// another transaction better. Charges are compared rather than orders, since
+// an order shipped in several parts has a charge, and a transaction, per
+// shipment.
+func assign(results []Result) {
+	// the columns are every distinct charge, then a "no proposal" column per
+	// transaction
+	columns := map[int]int{}
+	for _, res := range results {
+		for _, c := range res.Candidates {
+			if _, ok := columns[c.charge]; !ok {
+				columns[c.charge] = len(columns)
+			}
+		}
+	}
+	charges := len(columns)
+
+	cost := make([][]int64, len(results))
+	for i, res := range results {
+		cost[i] = make([]int64, charges+len(results))
+		for j := range cost[i] {
+			cost[i][j] = noMatch
+		}
+		// going without costs the same as a candidate with a score of 0
+		cost[i][charges+i] = scale
+		for _, c := range res.Candidates {
+			cost[i][columns[c.charge]] = scale - int64(math.Round(c.Score*scale))
+		}
+	}
+
+	rowCol := hungarian(cost)
+
+	// which transaction and candidate each charge went to
+	type owner struct{ row, candidate int }
+	owners := map[int]owner{}
+	for i, res := range results {
+		results[i].Proposed = -1
+		for k, c := range res.Candidates {
+			if columns[c.charge] == rowCol[i] {
+				results[i].Proposed = k
+				owners[rowCol[i]] = owner{i, k}
+			}
+		}
+	}
+	for i, res := range results {
+		for k, c := range res.Candidates {
+			o, ok := owners[columns[c.charge]]
+			results[i].Candidates[k].Proposed = ok && o.row == i
+			results[i].Candidates[k].Elsewhere = ok && o.row != i
+		}
+	}
+
+	// a proposal, or the lack of one, is ambiguous if trading charges with
+	// another transaction, or taking a free charge instead, scores just as
+	// well
+	for i, res := range results {
+		mine := rowCol[i]
+		for _, c := range res.Candidates {
+			col := columns[c.charge]
+			if col == mine {
+				continue
+			}
+			o, taken := owners[col]
+			if !taken {
+				if cost[i][col] <= cost[i][mine] {
+					results[i].Ambiguous = true
+				}
+				continue
+			}
+			// the other transaction would take our charge, or go without
+			replacement := mine
+			if res.Proposed < 0 {
+				replacement = charges + o.row
+			}
+			if cost[o.row][replacement] == noMatch {
+				continue
+			}
+			if cost[i][col]+cost[o.row][replacement] <= cost[i][mine]+cost[o.row][col] {
+				results[i].Ambiguous = true
+				results[o.row].Ambiguous = true
+			}
+		}
+	}
+}
+
+// hungarian solves the assignment problem for a cost matrix with no more rows
+// than columns, returning the column assigned to each row. It's the O(n²m)
+// shortest augmenting path version of the Hungarian algorithm.
+func hungarian(cost [][]int64) []int {
+	n := len(cost)
+	if n == 0 {
+		return nil
+	}
+	m := len(cost[0])
+
+	// 1-indexed, with row and column 0 as sentinels
+	u := make([]int64, n+1)
+	v := make([]int64, m+1)
+	p := make([]int, m+1) // p[j] is the row assigned to column j
+	way := make([]int, m+1)
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		minv := make([]int64, m+1)
+		used := make([]bool, m+1)
+		for j := range minv {
+			minv[j] = math.MaxInt64
+		}
+		for {
+			used[j0] = true
+			i0, delta, j1 := p[j0], int64(math.MaxInt64), 0
+			for j := 1; j <= m; j++ {
+				if used[j] {
+					continue
+				}
+				if cur := cost[i0-1][j-1] - u[i0] - v[j]; cur < minv[j] {
+					minv[j], way[j] = cur, j0
+				}
+				if minv[j] < delta {
+					delta, j1 = minv[j], j
+				}
+			}
+			for j := 0; j <= m; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if p[j0] == 0 {
+				break
+			}
+		}
+		for j0 != 0 {
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+		}
+	}
+
+	rowCol := make([]int, n)
+	for j := 1; j <= m; j++ {
+		if p[j] != 0 {
+			rowCol[p[j]-1] = j - 1
+		}
+	}
+	return rowCol
+}
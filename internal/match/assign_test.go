@@ -0,0 +1,157 @@
+package match
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+func TestAssign(t *testing.T) {
+	tests := []struct {
+		name         string
+		transactions []models.UnapprovedTransaction
+		charges      []models.OrderCharge
+		// proposed is the index of the charge proposed for each
+		// transaction, -1 for none
+		proposed []int
+	}{
+		{
+			name: "equal transactions get different charges",
+			transactions: []models.UnapprovedTransaction{
+				transaction("t1", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+				transaction("t2", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+			},
+			charges: []models.OrderCharge{
+				charge("o1", -19990, "2024-01-03", visa),
+				charge("o2", -19990, "2024-01-03", visa),
+			},
+			proposed: []int{0, 1},
+		},
+		{
+			name: "identical shipments of one order",
+			transactions: []models.UnapprovedTransaction{
+				transaction("t1", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+				transaction("t2", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+			},
+			charges: []models.OrderCharge{
+				charge("o1", -19990, "2024-01-03", visa),
+				charge("o1", -19990, "2024-01-03", visa),
+			},
+			proposed: []int{0, 1},
+		},
+		{
+			name: "more transactions than charges",
+			transactions: []models.UnapprovedTransaction{
+				transaction("t1", -19990, "2024-01-01", "Amazon", "Visa 1234"),
+				transaction("t2", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+			},
+			charges: []models.OrderCharge{
+				charge("o1", -19990, "2024-01-03", visa),
+			},
+			proposed: []int{-1, 0},
+		},
+		{
+			name: "best total rather than greedy",
+			// t1 alone would take o2, its best, leaving t2 with nothing,
+			// since o1 is too long before t2
+			transactions: []models.UnapprovedTransaction{
+				transaction("t1", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+				transaction("t2", -19990, "2024-01-05", "Amazon", "Visa 1234"),
+			},
+			charges: []models.OrderCharge{
+				charge("o1", -19990, "2024-01-01", visa),
+				charge("o2", -19990, "2024-01-03", visa),
+			},
+			proposed: []int{0, 1},
+		},
+		{
+			name: "different amounts",
+			transactions: []models.UnapprovedTransaction{
+				transaction("t1", -5000, "2024-01-03", "Amazon", "Visa 1234"),
+				transaction("t2", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+			},
+			charges: []models.OrderCharge{
+				charge("o1", -19990, "2024-01-03", visa),
+				charge("o2", -5000, "2024-01-03", visa),
+			},
+			proposed: []int{1, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultConfig()
+			c.MaxGroup = 0
+			results := c.Match(tt.transactions, tt.charges)
+
+			used := map[int]string{}
+			for i, res := range results {
+				got := -1
+				if res.Proposed >= 0 {
+					got = res.Candidates[res.Proposed].charge
+					if other, ok := used[got]; ok {
+						t.Errorf("charge %d proposed for %s and %s", got, other, res.Transaction.ID)
+					}
+					used[got] = string(res.Transaction.ID)
+				}
+				if got != tt.proposed[i] {
+					t.Errorf("%s: proposed charge %d, want %d", res.Transaction.ID, got, tt.proposed[i])
+				}
+				for k, cand := range res.Candidates {
+					if cand.Proposed != (k == res.Proposed) {
+						t.Errorf("%s: candidate %d Proposed = %v", res.Transaction.ID, k, cand.Proposed)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAssignElsewhere(t *testing.T) {
+	results := DefaultConfig().Match(
+		[]models.UnapprovedTransaction{
+			transaction("t1", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+			transaction("t2", -19990, "2024-01-05", "Amazon", "Visa 1234"),
+		},
+		[]models.OrderCharge{
+			charge("o1", -19990, "2024-01-03", visa),
+			charge("o2", -19990, "2024-01-05", visa),
+		},
+	)
+	for _, res := range results {
+		for _, c := range res.Candidates {
+			if c.Elsewhere == c.Proposed {
+				t.Errorf("%s: %s is Proposed %v and Elsewhere %v", res.Transaction.ID, c.ID, c.Proposed, c.Elsewhere)
+			}
+		}
+	}
+}
+
+func TestHungarian(t *testing.T) {
+	tests := []struct {
+		name string
+		cost [][]int64
+		want []int
+	}{
+		{"empty", nil, nil},
+		{"one", [][]int64{{5}}, []int{0}},
+		{"diagonal", [][]int64{{1, 9}, {9, 1}}, []int{0, 1}},
+		{"crossed", [][]int64{{9, 1}, {1, 9}}, []int{1, 0}},
+		{
+			name: "not greedy",
+			// row 0's cheapest is column 0, but the total is lower if it
+			// takes column 1
+			cost: [][]int64{{1, 2, noMatch}, {1, noMatch, noMatch}},
+			want: []int{1, 0},
+		},
+		{"more columns", [][]int64{{7, 3, 5}}, []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hungarian(tt.cost); !slices.Equal(got, tt.want) {
+				t.Errorf("hungarian() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
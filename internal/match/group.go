@@ -0,0 +1,310 @@
+package match
+
+import (
+	"cmp"
+	"container/heap"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// the search for groups is bounded so a busy week can't make the page hang
+const (
+	// maxPool is how many charges, the closest in time, are combined
+	maxPool = 24
+	// maxSteps is how many partial groups are tried per transaction
+	maxSteps = 100_000
+	// maxGroups is how many groups are kept per transaction
+	maxGroups = 3
+)
+
+// Group is several charges that add up to a transaction together
+type Group struct {
+	Charges []models.OrderCharge
+	// Score is how good a match this is, from 0 to 1, like Candidate.Score
+	// but going by the furthest charge and the least matching card
+	Score       float64
+	AmountDelta models.Money
+	// Days is how many days the furthest charge is from the transaction
+	Days int
+	// Proposed is whether this is the group proposed for the transaction
+	Proposed bool
+	// Elsewhere is whether any of the charges are proposed for another
+	// transaction, on their own or in a group
+	Elsewhere bool
+
+	// charges are the indexes of the charges in what Match was given
+	charges []int
+}
+
+// OrderIDs is the group's order IDs, comma-separated
+func (g Group) OrderIDs() string {
+	ids := make([]string, len(g.Charges))
+	for i, oc := range g.Charges {
+		ids[i] = oc.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+// Amount is the total of the group's charges
+func (g Group) Amount() models.Money {
+	var total models.Money
+	for _, oc := range g.Charges {
+		total += oc.Charge.Amount
+	}
+	return total
+}
+
+// group finds the groups for the transactions without a proposal, out of the
+// charges not proposed for anything else, and proposes a group for each
+// transaction it can
+func (c Config) group(results []Result, charges []models.OrderCharge) {
+	if c.MaxGroup < 2 {
+		return
+	}
+	taken := map[int]bool{}
+	for _, res := range results {
+		if res.Proposed >= 0 {
+			taken[res.Candidates[res.Proposed].charge] = true
+		}
+	}
+	var grouped []int
+	for i, res := range results {
+		if res.Proposed >= 0 {
+			continue
+		}
+		results[i].Groups, _ = c.groups(res.Transaction, charges, taken)
+		if len(results[i].Groups) > 0 {
+			grouped = append(grouped, i)
+		}
+	}
+	proposeGroups(results, grouped)
+}
+
+// proposeGroups proposes each transaction's best group, so that no charge is
+// proposed for two transactions. The best groups go first. A transaction
+// whose best group is tied, with another of its own or with one proposed for
+// another transaction, is ambiguous and gets no proposal.
+func proposeGroups(results []Result, grouped []int) {
+	slices.SortStableFunc(grouped, func(a, b int) int {
+		return cmp.Compare(results[b].Groups[0].Score, results[a].Groups[0].Score)
+	})
+	// claimed is which transaction's proposed group each charge is in
+	claimed := map[int]int{}
+	for _, i := range grouped {
+		groups := results[i].Groups
+		if len(groups) > 1 && groups[0].Score == groups[1].Score {
+			results[i].Ambiguous = true
+			continue
+		}
+		k := slices.IndexFunc(groups, func(g Group) bool {
+			return !slices.ContainsFunc(g.charges, func(j int) bool { _, ok := claimed[j]; return ok })
+		})
+		if k == 0 {
+			groups[0].Proposed = true
+			for _, j := range groups[0].charges {
+				claimed[j] = i
+			}
+			continue
+		}
+		// another transaction took some of the charges of the best group; if
+		// its group was just as good, neither can be proposed
+		for _, j := range groups[0].charges {
+			other, ok := claimed[j]
+			if !ok {
+				continue
+			}
+			for g := range results[other].Groups {
+				if results[other].Groups[g].Proposed && results[other].Groups[g].Score == groups[0].Score {
+					results[other].Groups[g].Proposed = false
+					results[other].Ambiguous = true
+					results[i].Ambiguous = true
+				}
+			}
+		}
+	}
+
+	// ties leave charges claimed, so nothing worse gets them, but only the
+	// proposed groups are elsewhere
+	proposed := map[int]int{}
+	for _, i := range grouped {
+		for _, g := range results[i].Groups {
+			if g.Proposed {
+				for _, j := range g.charges {
+					proposed[j] = i
+				}
+			}
+		}
+	}
+	elsewhere := func(i, j int) bool {
+		other, ok := proposed[j]
+		return ok && other != i
+	}
+	for i := range results {
+		for k := range results[i].Candidates {
+			if elsewhere(i, results[i].Candidates[k].charge) {
+				results[i].Candidates[k].Elsewhere = true
+			}
+		}
+		for k := range results[i].Groups {
+			results[i].Groups[k].Elsewhere = slices.ContainsFunc(results[i].Groups[k].charges, func(j int) bool { return elsewhere(i, j) })
+		}
+	}
+}
+
+// groups searches for sets of 2 to MaxGroup charges that aren't taken, from
+// different orders, whose amounts add up to the transaction's within
+// tolerance. It also reports how many partial groups it tried.
+func (c Config) groups(t models.UnapprovedTransaction, charges []models.OrderCharge, taken map[int]bool) ([]Group, int) {
+	target := t.Amount.Abs()
+	type option struct {
+		oc       models.OrderCharge
+		charge   int
+		amount   models.Money
+		distance time.Duration
+		card     int
+	}
+	var pool []option
+	for j, oc := range charges {
+		if taken[j] {
+			continue
+		}
+		amount := oc.Charge.Amount.Abs()
+		charged, err := oc.Charge.Time()
+		if err != nil || amount == 0 || amount > target+c.AmountTolerance {
+			continue
+		}
+		if distance := t.Date.Sub(charged).Abs(); distance <= c.Window {
+			pool = append(pool, option{oc, j, amount, distance, sameCard(oc.Charge.Card, t.Account)})
+		}
+	}
+	slices.SortStableFunc(pool, func(a, b option) int { return cmp.Compare(a.distance, b.distance) })
+	pool = pool[:min(len(pool), maxPool)]
+
+	// biggest first, so the remaining total only shrinks and a search can
+	// stop once it can't reach the target
+	slices.SortStableFunc(pool, func(a, b option) int { return cmp.Compare(b.amount, a.amount) })
+	remaining := make([]models.Money, len(pool)+1)
+	for i := len(pool) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + pool[i].amount
+	}
+
+	// the search only scores what it finds, and keeps the best few; Groups
+	// are built for those at the end
+	_, isAmazon := c.rate(t, 0, 0, 0)
+	var (
+		best   groupHeap
+		chosen []int
+		steps  int
+	)
+	var search func(start int, sum models.Money, furthest time.Duration, card int)
+	search = func(start int, sum models.Money, furthest time.Duration, card int) {
+		if steps == maxSteps {
+			return
+		}
+		steps++
+		if len(chosen) >= 2 && (target-sum).Abs() <= c.AmountTolerance {
+			found := foundGroup{
+				score: c.weigh((target - sum).Abs(), furthest, card, isAmazon),
+				size:  len(chosen),
+				seq:   steps,
+			}
+			if len(best) < maxGroups || found.better(best[0]) {
+				found.chosen = slices.Clone(chosen)
+				found.sum = sum
+				heap.Push(&best, found)
+				if len(best) > maxGroups {
+					heap.Pop(&best)
+				}
+			}
+		}
+		if len(chosen) == c.MaxGroup {
+			return
+		}
+		for i := start; i < len(pool); i++ {
+			if sum+remaining[i] < target-c.AmountTolerance {
+				return
+			}
+			if sum+pool[i].amount > target+c.AmountTolerance {
+				continue
+			}
+			if slices.ContainsFunc(chosen, func(j int) bool { return pool[j].oc.ID == pool[i].oc.ID }) {
+				continue
+			}
+			chosen = append(chosen, i)
+			search(i+1, sum+pool[i].amount, max(furthest, pool[i].distance), min(card, pool[i].card))
+			chosen = chosen[:len(chosen)-1]
+		}
+	}
+	search(0, 0, 0, 1)
+
+	slices.SortFunc(best, func(a, b foundGroup) int {
+		if a.better(b) {
+			return -1
+		}
+		return 1
+	})
+	groups := make([]Group, len(best))
+	for k, f := range best {
+		group := make([]models.OrderCharge, len(f.chosen))
+		indexes := make([]int, len(f.chosen))
+		for n, j := range f.chosen {
+			group[n], indexes[n] = pool[j].oc, pool[j].charge
+		}
+		groups[k] = c.newGroup(t, f.sum, group, indexes)
+	}
+	return groups, steps
+}
+
+// foundGroup is a group the search found, before it's made into a Group
+type foundGroup struct {
+	score float64
+	size  int
+	// seq orders groups found earlier first, among equals
+	seq int
+	// chosen are the indexes of the charges in the search's pool
+	chosen []int
+	sum    models.Money
+}
+
+// better ranks groups by score, then the fewest charges
+func (f foundGroup) better(other foundGroup) bool {
+	if f.score != other.score {
+		return f.score > other.score
+	}
+	if f.size != other.size {
+		return f.size < other.size
+	}
+	return f.seq < other.seq
+}
+
+// groupHeap keeps the best groups found so far, with the worst on top
+type groupHeap []foundGroup
+
+func (h groupHeap) Len() int           { return len(h) }
+func (h groupHeap) Less(i, j int) bool { return h[j].better(h[i]) }
+func (h groupHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *groupHeap) Push(x any)        { *h = append(*h, x.(foundGroup)) }
+func (h *groupHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func (c Config) newGroup(t models.UnapprovedTransaction, sum models.Money, charges []models.OrderCharge, indexes []int) Group {
+	g := Group{Charges: charges, AmountDelta: (t.Amount.Abs() - sum).Abs(), charges: indexes}
+	var furthest time.Duration
+	card := 1
+	for _, oc := range charges {
+		if charged, err := oc.Charge.Time(); err == nil {
+			furthest = max(furthest, t.Date.Sub(charged).Abs())
+		}
+		card = min(card, sameCard(oc.Charge.Card, t.Account))
+	}
+	g.Days = days(furthest)
+	g.Score, _ = c.rate(t, g.AmountDelta, furthest, card)
+	return g
+}
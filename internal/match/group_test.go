@@ -0,0 +1,305 @@
+package match
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+func TestGroups(t *testing.T) {
+	t1 := transaction("t1", -10000, "2024-01-03", "Amazon", "Visa 1234")
+
+	// decoys are close charges that can't add up to t1
+	decoys := func(n int) []models.OrderCharge {
+		var charges []models.OrderCharge
+		for i := range n {
+			charges = append(charges, charge(fmt.Sprintf("decoy%d", i), -9990, "2024-01-03", visa))
+		}
+		return charges
+	}
+
+	tests := []struct {
+		name     string
+		maxGroup int
+		charges  []models.OrderCharge
+		// want is the order IDs of each group, best first
+		want      []string
+		ambiguous bool
+	}{
+		{
+			name: "two orders",
+			charges: []models.OrderCharge{
+				charge("o1", -6000, "2024-01-03", visa),
+				charge("o2", -4000, "2024-01-03", visa),
+				charge("o3", -2500, "2024-01-03", visa),
+			},
+			want: []string{"o1,o2"},
+		},
+		{
+			name: "closer group first",
+			charges: []models.OrderCharge{
+				charge("o1", -6000, "2024-01-03", visa),
+				charge("o2", -4000, "2024-01-03", visa),
+				charge("o3", -7000, "2024-01-01", visa),
+				charge("o4", -3000, "2024-01-01", visa),
+			},
+			want: []string{"o1,o2", "o3,o4"},
+		},
+		{
+			name: "just as good",
+			charges: []models.OrderCharge{
+				charge("o1", -6000, "2024-01-03", visa),
+				charge("o2", -4000, "2024-01-03", visa),
+				charge("o3", -7000, "2024-01-03", visa),
+				charge("o4", -3000, "2024-01-03", visa),
+			},
+			want:      []string{"o3,o4", "o1,o2"},
+			ambiguous: true,
+		},
+		{
+			name: "charges of the same order aren't a group",
+			charges: []models.OrderCharge{
+				charge("o1", -6000, "2024-01-03", visa),
+				charge("o1", -4000, "2024-01-03", visa),
+			},
+		},
+		{
+			name: "three orders",
+			charges: []models.OrderCharge{
+				charge("o1", -5000, "2024-01-03", visa),
+				charge("o2", -3000, "2024-01-03", visa),
+				charge("o3", -2000, "2024-01-03", visa),
+			},
+			want: []string{"o1,o2,o3"},
+		},
+		{
+			name:     "more orders than MaxGroup",
+			maxGroup: 2,
+			charges: []models.OrderCharge{
+				charge("o1", -5000, "2024-01-03", visa),
+				charge("o2", -3000, "2024-01-03", visa),
+				charge("o3", -2000, "2024-01-03", visa),
+			},
+		},
+		{
+			name:     "turned off",
+			maxGroup: 1,
+			charges: []models.OrderCharge{
+				charge("o1", -6000, "2024-01-03", visa),
+				charge("o2", -4000, "2024-01-03", visa),
+			},
+		},
+		{
+			name: "outside the window",
+			charges: []models.OrderCharge{
+				charge("o1", -6000, "2024-01-03", visa),
+				charge("o2", -4000, "2023-12-25", visa),
+			},
+		},
+		{
+			name: "at most maxGroups",
+			charges: []models.OrderCharge{
+				charge("o1", -6000, "2024-01-03", visa),
+				charge("o2", -4000, "2024-01-03", visa),
+				charge("o3", -7000, "2024-01-02", visa),
+				charge("o4", -3000, "2024-01-02", visa),
+				charge("o5", -8000, "2024-01-01", visa),
+				charge("o6", -2000, "2024-01-01", visa),
+				charge("o7", -9000, "2023-12-31", visa),
+				charge("o8", -1000, "2023-12-31", visa),
+			},
+			want: []string{"o1,o2", "o3,o4", "o5,o6"},
+		},
+		{
+			name: "only the closest maxPool charges are combined",
+			charges: append(decoys(maxPool), []models.OrderCharge{
+				charge("o1", -6000, "2024-01-01", visa),
+				charge("o2", -4000, "2024-01-01", visa),
+			}...),
+		},
+		{
+			name: "room in the pool",
+			charges: append(decoys(maxPool-2), []models.OrderCharge{
+				charge("o1", -6000, "2024-01-01", visa),
+				charge("o2", -4000, "2024-01-01", visa),
+			}...),
+			want: []string{"o1,o2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultConfig()
+			if tt.maxGroup != 0 {
+				c.MaxGroup = tt.maxGroup
+			}
+			res := c.Match([]models.UnapprovedTransaction{t1}, tt.charges)[0]
+			if res.Proposed >= 0 {
+				t.Fatalf("proposed %s", res.Candidates[res.Proposed].ID)
+			}
+			var got []string
+			for _, g := range res.Groups {
+				got = append(got, g.OrderIDs())
+				if g.Amount().Abs() != t1.Amount.Abs() {
+					t.Errorf("group %s adds up to %s", g.OrderIDs(), g.Amount())
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("groups = %v, want %v", got, tt.want)
+			}
+			if res.Ambiguous != tt.ambiguous {
+				t.Errorf("Ambiguous = %v, want %v", res.Ambiguous, tt.ambiguous)
+			}
+			for k, g := range res.Groups {
+				if want := k == 0 && !tt.ambiguous; g.Proposed != want {
+					t.Errorf("group %s Proposed = %v, want %v", g.OrderIDs(), g.Proposed, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGroupsCompete(t *testing.T) {
+	pair := []models.OrderCharge{
+		charge("o1", -6000, "2024-01-03", visa),
+		charge("o2", -4000, "2024-01-03", visa),
+	}
+	tests := []struct {
+		name         string
+		transactions []models.UnapprovedTransaction
+		charges      []models.OrderCharge
+		// proposed is the group proposed for each transaction, "" for none
+		proposed  []string
+		ambiguous []bool
+		elsewhere []bool
+	}{
+		{
+			name: "same amount, same day, one pair of orders",
+			transactions: []models.UnapprovedTransaction{
+				transaction("t1", -10000, "2024-01-03", "Amazon", "Visa 1234"),
+				transaction("t2", -10000, "2024-01-03", "Amazon", "Visa 1234"),
+			},
+			charges:   pair,
+			proposed:  []string{"", ""},
+			ambiguous: []bool{true, true},
+			elsewhere: []bool{false, false},
+		},
+		{
+			name: "the closer transaction gets the pair",
+			transactions: []models.UnapprovedTransaction{
+				transaction("t1", -10000, "2024-01-05", "Amazon", "Visa 1234"),
+				transaction("t2", -10000, "2024-01-03", "Amazon", "Visa 1234"),
+			},
+			charges:   pair,
+			proposed:  []string{"", "o1,o2"},
+			ambiguous: []bool{false, false},
+			elsewhere: []bool{true, false},
+		},
+		{
+			name: "a pair each",
+			transactions: []models.UnapprovedTransaction{
+				transaction("t1", -10000, "2024-01-03", "Amazon", "Visa 1234"),
+				transaction("t2", -10000, "2024-01-10", "Amazon", "Visa 1234"),
+			},
+			charges: append(slices.Clone(pair),
+				charge("o3", -7000, "2024-01-10", visa),
+				charge("o4", -3000, "2024-01-10", visa),
+			),
+			proposed:  []string{"o1,o2", "o3,o4"},
+			ambiguous: []bool{false, false},
+			elsewhere: []bool{false, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := DefaultConfig().Match(tt.transactions, tt.charges)
+			used := map[string]string{}
+			for i, res := range results {
+				if len(res.Groups) == 0 {
+					t.Fatalf("%s has no groups", res.Transaction.ID)
+				}
+				var proposed string
+				for _, g := range res.Groups {
+					if !g.Proposed {
+						continue
+					}
+					proposed = g.OrderIDs()
+					for _, oc := range g.Charges {
+						if other, ok := used[oc.ID]; ok {
+							t.Errorf("%s proposed for %s and %s", oc.ID, other, res.Transaction.ID)
+						}
+						used[oc.ID] = string(res.Transaction.ID)
+					}
+				}
+				if proposed != tt.proposed[i] {
+					t.Errorf("%s: proposed %q, want %q", res.Transaction.ID, proposed, tt.proposed[i])
+				}
+				if res.Ambiguous != tt.ambiguous[i] {
+					t.Errorf("%s: Ambiguous = %v, want %v", res.Transaction.ID, res.Ambiguous, tt.ambiguous[i])
+				}
+				if res.Groups[0].Elsewhere != tt.elsewhere[i] {
+					t.Errorf("%s: best group Elsewhere = %v, want %v", res.Transaction.ID, res.Groups[0].Elsewhere, tt.elsewhere[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGroupsOnlyWithoutProposal(t *testing.T) {
+	results := DefaultConfig().Match(
+		[]models.UnapprovedTransaction{
+			transaction("t1", -10000, "2024-01-03", "Amazon", "Visa 1234"),
+			transaction("t2", -6000, "2024-01-03", "Amazon", "Visa 1234"),
+		},
+		[]models.OrderCharge{
+			charge("o1", -10000, "2024-01-03", visa),
+			charge("o2", -6000, "2024-01-03", visa),
+			charge("o3", -4000, "2024-01-03", visa),
+		},
+	)
+	for _, res := range results {
+		if len(res.Groups) > 0 {
+			t.Errorf("%s has a proposal and groups %v", res.Transaction.ID, res.Groups)
+		}
+	}
+
+	// o2 is proposed for t2, so t1 can't use it in a group
+	results = DefaultConfig().Match(
+		[]models.UnapprovedTransaction{
+			transaction("t1", -10000, "2024-01-03", "Amazon", "Visa 1234"),
+			transaction("t2", -6000, "2024-01-03", "Amazon", "Visa 1234"),
+		},
+		[]models.OrderCharge{
+			charge("o2", -6000, "2024-01-03", visa),
+			charge("o3", -4000, "2024-01-03", visa),
+		},
+	)
+	if g := results[0].Groups; len(g) > 0 {
+		t.Errorf("t1 groups = %v, want none", g)
+	}
+}
+
+func TestGroupsBounded(t *testing.T) {
+	// every set of ten of these adds up, far too many to try them all
+	var charges []models.OrderCharge
+	for i := range 40 {
+		charges = append(charges, charge(fmt.Sprintf("o%d", i), -1000, "2024-01-03", visa))
+	}
+	c := DefaultConfig()
+	c.MaxGroup = 10
+
+	groups, steps := c.groups(transaction("t1", -10000, "2024-01-03", "Amazon", "Visa 1234"), charges, nil)
+	if steps != maxSteps {
+		t.Errorf("tried %d partial groups, want it to stop at %d", steps, maxSteps)
+	}
+	if len(groups) == 0 || len(groups) > maxGroups {
+		t.Errorf("found %d groups, want 1 to %d", len(groups), maxGroups)
+	}
+	for _, g := range groups {
+		if len(g.Charges) != 10 || g.AmountDelta != 0 {
+			t.Errorf("group of %d charges, %v off, want 10 adding up", len(g.Charges), g.AmountDelta)
+		}
+	}
+}
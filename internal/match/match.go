@@ -0,0 +1,194 @@
+// Package match pairs unapproved YNAB transactions with the Amazon charges
+// that probably caused them. Each candidate charge gets a score from how
+// close its amount and date are, whether its card is the transaction's
+// account and whether the payee looks like Amazon.
+package match
+
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// Config sets how loosely charges match transactions
+type Config struct {
+	// AmountTolerance is how far a charge's amount can be from the
+	// transaction's. Zero means they have to be equal.
+	AmountTolerance models.Money
+	// Window is how far apart the charge and transaction dates can be
+	Window time.Duration
+	// Payee matches payees that look like Amazon
+	Payee *regexp.Regexp
+	// MaxGroup is the most charges to add up when looking for several
+	// orders billed together. Less than 2 turns it off.
+	MaxGroup int
+}
+
+// DefaultConfig matches exact amounts within three days
+func DefaultConfig() Config {
+	return Config{
+		Window:   72 * time.Hour,
+		Payee:    regexp.MustCompile(`(?i)amazon|amzn`),
+		MaxGroup: 4,
+	}
+}
+
+// weights of each part of the score, adding up to 1
+const (
+	amountWeight = 0.5
+	dateWeight   = 0.3
+	cardWeight   = 0.1
+	payeeWeight  = 0.1
+)
+
+// Candidate is a charge that might be the transaction
+type Candidate struct {
+	models.OrderCharge
+	// Score is how good a match this is, from 0 to 1
+	Score float64
+	// AmountDelta is how far the charge is from the transaction amount
+	AmountDelta models.Money
+	// Days is how many days apart the charge and transaction are
+	Days int
+	// Card is whether the charge's card is the transaction's account: 1 if
+	// the last four digits agree, -1 if they don't, 0 if we can't tell
+	Card int
+	// Payee is whether the transaction's payee looks like Amazon
+	Payee bool
+	// Proposed is whether this is the charge proposed for the transaction
+	Proposed bool
+	// Elsewhere is whether the charge is proposed for another transaction
+	Elsewhere bool
+
+	// charge is the index of the charge in what Match was given, which
+	// tells identical charges apart
+	charge int
+}
+
+// Result is the candidates for one transaction
+type Result struct {
+	Transaction models.UnapprovedTransaction
+	// Candidates are best first
+	Candidates []Candidate
+	// Proposed is the index of the candidate proposed for the transaction, or
+	// -1 if there isn't one
+	Proposed int
+	// Ambiguous means another proposal would have scored as well, like for
+	// two charges and two transactions of the same amount on the same day
+	Ambiguous bool
+	// Groups are sets of charges that add up to the transaction, for when
+	// Amazon billed several orders at once. They're only looked for when
+	// no single charge was proposed, best first, and at most one is
+	// proposed.
+	Groups []Group
+}
+
+// Between is the dates to look for charges for the given transactions in
+func (c Config) Between(transactions []models.UnapprovedTransaction) (from, to time.Time) {
+	for i, t := range transactions {
+		if i == 0 || t.Date.Before(from) {
+			from = t.Date
+		}
+		if i == 0 || t.Date.After(to) {
+			to = t.Date
+		}
+	}
+	return from.Add(-c.Window), to.Add(c.Window)
+}
+
+// Match scores the charges against each transaction, keeping the ones within
+// tolerance, and proposes one charge per transaction so that no charge is
+// proposed twice. Transactions left without a proposal get groups of the
+// remaining charges that add up to them, again proposing each charge for at
+// most one transaction. Results are in the same order as transactions.
+func (c Config) Match(transactions []models.UnapprovedTransaction, charges []models.OrderCharge) []Result {
+	results := make([]Result, len(transactions))
+	for i, t := range transactions {
+		results[i].Transaction = t
+		for j, oc := range charges {
+			if candidate, ok := c.score(t, oc); ok {
+				candidate.charge = j
+				results[i].Candidates = append(results[i].Candidates, candidate)
+			}
+		}
+		slices.SortStableFunc(results[i].Candidates, func(a, b Candidate) int {
+			return cmp.Compare(b.Score, a.Score)
+		})
+	}
+	assign(results)
+	c.group(results, charges)
+	return results
+}
+
+// score rates a charge against a transaction, reporting false if it's out of
+// tolerance
+func (c Config) score(t models.UnapprovedTransaction, oc models.OrderCharge) (Candidate, bool) {
+	candidate := Candidate{OrderCharge: oc}
+
+	// charges and transactions might not agree on the sign
+	candidate.AmountDelta = (t.Amount.Abs() - oc.Charge.Amount.Abs()).Abs()
+	if candidate.AmountDelta > c.AmountTolerance {
+		return candidate, false
+	}
+	charged, err := oc.Charge.Time()
+	if err != nil {
+		return candidate, false
+	}
+	distance := t.Date.Sub(charged).Abs()
+	if distance > c.Window {
+		return candidate, false
+	}
+	candidate.Days = days(distance)
+	candidate.Card = sameCard(oc.Charge.Card, t.Account)
+	candidate.Score, candidate.Payee = c.rate(t, candidate.AmountDelta, distance, candidate.Card)
+	return candidate, true
+}
+
+// rate combines the parts of a match into a score, also reporting whether the
+// payee looks like Amazon
+func (c Config) rate(t models.UnapprovedTransaction, delta models.Money, distance time.Duration, sameCard int) (float64, bool) {
+	isAmazon := c.Payee != nil && c.Payee.MatchString(t.Payee)
+	return c.weigh(delta, distance, sameCard, isAmazon), isAmazon
+}
+
+// weigh is rate once the payee has been checked
+func (c Config) weigh(delta models.Money, distance time.Duration, sameCard int, isAmazon bool) float64 {
+	amount := 1.0
+	if c.AmountTolerance > 0 {
+		amount -= float64(delta) / float64(c.AmountTolerance+1)
+	}
+	date := 1.0
+	if c.Window > 0 {
+		date -= float64(distance) / float64(c.Window)
+	}
+	card := float64(sameCard+1) / 2
+	payee := 0.0
+	if isAmazon {
+		payee = 1
+	}
+	return amountWeight*amount + dateWeight*date + cardWeight*card + payeeWeight*payee
+}
+
+func days(d time.Duration) int {
+	return int(d.Round(24*time.Hour) / (24 * time.Hour))
+}
+
+// accountDigits finds card numbers in account names like "Visa 1234"
+var accountDigits = regexp.MustCompile(`\b\d{4}\b`)
+
+// sameCard compares the last four digits of a card and a YNAB account name,
+// see Candidate.Card
+func sameCard(card, account string) int {
+	last := models.Charge{Card: card}.LastFour()
+	digits := accountDigits.FindAllString(account, -1)
+	if last == "" || len(digits) == 0 {
+		return 0
+	}
+	if slices.Contains(digits, last) {
+		return 1
+	}
+	return -1
+}
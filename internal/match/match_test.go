@@ -0,0 +1,306 @@
+package match
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func transaction(id string, amount models.Money, on, payee, account string) models.UnapprovedTransaction {
+	return models.UnapprovedTransaction{
+		ID:      models.TransactionID(id),
+		Amount:  amount,
+		Date:    date(on),
+		Payee:   payee,
+		Account: account,
+	}
+}
+
+func charge(orderID string, amount models.Money, on, card string) models.OrderCharge {
+	return models.OrderCharge{
+		Order:  models.Order{ID: orderID},
+		Charge: models.Charge{Card: card, Amount: amount, Date: date(on).Format(models.ChargeDateLayout)},
+	}
+}
+
+const visa = "Visa ending in 1234"
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(*Config)
+		t      models.UnapprovedTransaction
+		charge models.OrderCharge
+		// want is the score, or -1 if the charge isn't a candidate
+		want float64
+		days int
+		card int
+	}{
+		{
+			name:   "exact",
+			t:      transaction("t", -19990, "2024-01-03", "AMZN Mktp US", "Visa 1234"),
+			charge: charge("o", -19990, "2024-01-03", visa),
+			want:   1,
+			card:   1,
+		},
+		{
+			name:   "a day apart",
+			t:      transaction("t", -19990, "2024-01-04", "AMZN Mktp US", "Visa 1234"),
+			charge: charge("o", -19990, "2024-01-03", visa),
+			want:   amountWeight + dateWeight*2/3 + cardWeight + payeeWeight,
+			days:   1,
+			card:   1,
+		},
+		{
+			name:   "at the edge of the window",
+			t:      transaction("t", -19990, "2024-01-06", "AMZN Mktp US", "Visa 1234"),
+			charge: charge("o", -19990, "2024-01-03", visa),
+			want:   amountWeight + cardWeight + payeeWeight,
+			days:   3,
+			card:   1,
+		},
+		{
+			name:   "outside the window",
+			t:      transaction("t", -19990, "2024-01-07", "AMZN Mktp US", "Visa 1234"),
+			charge: charge("o", -19990, "2024-01-03", visa),
+			want:   -1,
+		},
+		{
+			name:   "account without digits",
+			t:      transaction("t", -19990, "2024-01-03", "AMZN Mktp US", "Checking"),
+			charge: charge("o", -19990, "2024-01-03", visa),
+			want:   amountWeight + dateWeight + cardWeight/2 + payeeWeight,
+		},
+		{
+			name:   "another card",
+			t:      transaction("t", -19990, "2024-01-03", "AMZN Mktp US", "Visa 5678"),
+			charge: charge("o", -19990, "2024-01-03", visa),
+			want:   amountWeight + dateWeight + payeeWeight,
+			card:   -1,
+		},
+		{
+			name:   "payee isn't Amazon",
+			t:      transaction("t", -19990, "2024-01-03", "Corner Store", "Visa 1234"),
+			charge: charge("o", -19990, "2024-01-03", visa),
+			want:   amountWeight + dateWeight + cardWeight,
+			card:   1,
+		},
+		{
+			name:   "signs disagree",
+			t:      transaction("t", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+			charge: charge("o", 19990, "2024-01-03", visa),
+			want:   1,
+			card:   1,
+		},
+		{
+			name:   "a cent off with no tolerance",
+			t:      transaction("t", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+			charge: charge("o", -19980, "2024-01-03", visa),
+			want:   -1,
+		},
+		{
+			name:   "a cent off within tolerance",
+			config: func(c *Config) { c.AmountTolerance = 50 },
+			t:      transaction("t", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+			charge: charge("o", -19980, "2024-01-03", visa),
+			want:   amountWeight*(1-10.0/51) + dateWeight + cardWeight + payeeWeight,
+			card:   1,
+		},
+		{
+			name:   "past the tolerance",
+			config: func(c *Config) { c.AmountTolerance = 50 },
+			t:      transaction("t", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+			charge: charge("o", -19930, "2024-01-03", visa),
+			want:   -1,
+		},
+		{
+			name:   "wider window",
+			config: func(c *Config) { c.Window = 7 * 24 * time.Hour },
+			t:      transaction("t", -19990, "2024-01-10", "Amazon", "Visa 1234"),
+			charge: charge("o", -19990, "2024-01-03", visa),
+			want:   amountWeight + cardWeight + payeeWeight,
+			days:   7,
+			card:   1,
+		},
+		{
+			name:   "charge date we can't read",
+			t:      transaction("t", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+			charge: models.OrderCharge{Charge: models.Charge{Card: visa, Amount: -19990, Date: "soon"}},
+			want:   -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultConfig()
+			if tt.config != nil {
+				tt.config(&c)
+			}
+			got, ok := c.score(tt.t, tt.charge)
+			if tt.want < 0 {
+				if ok {
+					t.Fatalf("score() = %+v, want no candidate", got)
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("score() found no candidate")
+			}
+			if math.Abs(got.Score-tt.want) > 1e-9 {
+				t.Errorf("Score = %v, want %v", got.Score, tt.want)
+			}
+			if got.Days != tt.days || got.Card != tt.card {
+				t.Errorf("Days, Card = %d, %d, want %d, %d", got.Days, got.Card, tt.days, tt.card)
+			}
+		})
+	}
+}
+
+func TestSameCard(t *testing.T) {
+	tests := []struct {
+		card, account string
+		want          int
+	}{
+		{visa, "Visa 1234", 1},
+		{"Visa ****1234", "Visa 1234", 1},
+		{visa, "Rewards Visa (1234)", 1},
+		{visa, "Visa 5678", -1},
+		{visa, "Checking", 0},
+		{"Gift Card", "Visa 1234", 0},
+	}
+	for _, tt := range tests {
+		if got := sameCard(tt.card, tt.account); got != tt.want {
+			t.Errorf("sameCard(%q, %q) = %d, want %d", tt.card, tt.account, got, tt.want)
+		}
+	}
+}
+
+func TestMatchAmbiguous(t *testing.T) {
+	tests := []struct {
+		name         string
+		transactions []models.UnapprovedTransaction
+		charges      []models.OrderCharge
+		// proposed is the order proposed for each transaction, "" for none
+		proposed  []string
+		ambiguous []bool
+	}{
+		{
+			name:         "one charge",
+			transactions: []models.UnapprovedTransaction{transaction("t1", -19990, "2024-01-03", "Amazon", "Visa 1234")},
+			charges:      []models.OrderCharge{charge("o1", -19990, "2024-01-03", visa)},
+			proposed:     []string{"o1"},
+			ambiguous:    []bool{false},
+		},
+		{
+			name:         "closer charge wins",
+			transactions: []models.UnapprovedTransaction{transaction("t1", -19990, "2024-01-03", "Amazon", "Visa 1234")},
+			charges: []models.OrderCharge{
+				charge("o1", -19990, "2024-01-01", visa),
+				charge("o2", -19990, "2024-01-03", visa),
+			},
+			proposed:  []string{"o2"},
+			ambiguous: []bool{false},
+		},
+		{
+			name:         "two charges just as good",
+			transactions: []models.UnapprovedTransaction{transaction("t1", -19990, "2024-01-03", "Amazon", "Visa 1234")},
+			charges: []models.OrderCharge{
+				charge("o1", -19990, "2024-01-03", visa),
+				charge("o2", -19990, "2024-01-03", visa),
+			},
+			proposed:  []string{"o1"},
+			ambiguous: []bool{true},
+		},
+		{
+			name: "two transactions and two charges on the same day",
+			transactions: []models.UnapprovedTransaction{
+				transaction("t1", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+				transaction("t2", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+			},
+			charges: []models.OrderCharge{
+				charge("o1", -19990, "2024-01-03", visa),
+				charge("o2", -19990, "2024-01-03", visa),
+			},
+			proposed:  []string{"o1", "o2"},
+			ambiguous: []bool{true, true},
+		},
+		{
+			name: "the dates tell them apart",
+			transactions: []models.UnapprovedTransaction{
+				transaction("t1", -19990, "2024-01-03", "Amazon", "Visa 1234"),
+				transaction("t2", -19990, "2024-01-05", "Amazon", "Visa 1234"),
+			},
+			charges: []models.OrderCharge{
+				charge("o1", -19990, "2024-01-05", visa),
+				charge("o2", -19990, "2024-01-03", visa),
+			},
+			proposed:  []string{"o2", "o1"},
+			ambiguous: []bool{false, false},
+		},
+		{
+			name:         "nothing within tolerance",
+			transactions: []models.UnapprovedTransaction{transaction("t1", -19990, "2024-01-03", "Amazon", "Visa 1234")},
+			charges:      []models.OrderCharge{charge("o1", -5000, "2024-01-03", visa)},
+			proposed:     []string{""},
+			ambiguous:    []bool{false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := DefaultConfig().Match(tt.transactions, tt.charges)
+			for i, res := range results {
+				var proposed string
+				if res.Proposed >= 0 {
+					proposed = res.Candidates[res.Proposed].ID
+				}
+				if proposed != tt.proposed[i] {
+					t.Errorf("%s: proposed %q, want %q", res.Transaction.ID, proposed, tt.proposed[i])
+				}
+				if res.Ambiguous != tt.ambiguous[i] {
+					t.Errorf("%s: Ambiguous = %v, want %v", res.Transaction.ID, res.Ambiguous, tt.ambiguous[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMatchSortsCandidates(t *testing.T) {
+	results := DefaultConfig().Match(
+		[]models.UnapprovedTransaction{transaction("t1", -19990, "2024-01-04", "Amazon", "Visa 1234")},
+		[]models.OrderCharge{
+			charge("far", -19990, "2024-01-01", visa),
+			charge("near", -19990, "2024-01-04", visa),
+			charge("middle", -19990, "2024-01-03", visa),
+		},
+	)
+	var got []string
+	for _, c := range results[0].Candidates {
+		got = append(got, c.ID)
+	}
+	if want := []string{"near", "middle", "far"}; !slices.Equal(got, want) {
+		t.Errorf("candidates = %v, want %v", got, want)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	from, to := DefaultConfig().Between([]models.UnapprovedTransaction{
+		transaction("t1", -1000, "2024-01-10", "Amazon", ""),
+		transaction("t2", -1000, "2024-01-05", "Amazon", ""),
+		transaction("t3", -1000, "2024-01-07", "Amazon", ""),
+	})
+	if !from.Equal(date("2024-01-02")) || !to.Equal(date("2024-01-13")) {
+		t.Errorf("Between() = %v, %v", from, to)
+	}
+}
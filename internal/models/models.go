@@ -1,32 +1,161 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ChargeDateLayout is how Amazon displays charge dates on the transactions page
+const ChargeDateLayout = "January 2, 2006"
 
 type Charge struct {
-	Card   string  `json:"card"`
-	Amount float64 `json:"amount"`
-	Date   string  `json:"date"`
+	Card   string `json:"card"`
+	Amount Money  `json:"amount"`
+	Date   string `json:"date"`
 }
 
 func (c Charge) Time() (time.Time, error) {
-	return time.Parse("January 2, 2006", c.Date)
+	return time.Parse(ChargeDateLayout, c.Date)
 }
 
-// Cmp return a negative number when < other, a positive number when  > other,  and
-// zero when == other.
-func (c Charge) CmpTime(other Charge) int {
-	t1, _ := c.Time()
-	t2, _ := other.Time()
+// cardDigits finds the last four digits of a card however a page writes it,
+// like "Visa ending in 1234", "Visa ****1234" or "Visa - 1234"
+var cardDigits = regexp.MustCompile(`(?:^|\D)(\d{4})\D*$`)
+
+// LastFour is the last four digits of the charge's card, or "" if it doesn't
+// show them, like a gift card
+func (c Charge) LastFour() string {
+	if m := cardDigits.FindStringSubmatch(c.Card); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// Same reports whether two charges are the same card transaction, even when
+// they were read from pages that write the card differently. Cards are
+// compared by their last four digits when both show them.
+func (c Charge) Same(other Charge) bool {
+	if c.Amount != other.Amount {
+		return false
+	}
+	if a, b := c.LastFour(), other.LastFour(); a != "" && b != "" {
+		if a != b {
+			return false
+		}
+	} else if !strings.EqualFold(strings.TrimSpace(c.Card), strings.TrimSpace(other.Card)) {
+		return false
+	}
+	t1, err1 := c.Time()
+	t2, err2 := other.Time()
+	if err1 != nil || err2 != nil {
+		return c.Date == other.Date
+	}
+	return t1.Equal(t2)
+}
 
-	return int(t1.UnixMilli() - t2.UnixMilli())
+// Item is one line of an order
+type Item struct {
+	Title string `json:"title"`
+	// ASIN is Amazon's product ID, like B000000000
+	ASIN     string `json:"asin,omitempty"`
+	Quantity int    `json:"quantity"`
+	// UnitPrice is the price of one, before tax and shipping
+	UnitPrice Money  `json:"unitPrice"`
+	Seller    string `json:"seller,omitempty"`
+	URL       string `json:"url,omitempty"`
 }
 
+// UnmarshalJSON also accepts a bare title, which is all older versions of the
+// bookmarklet send. The quantity defaults to 1.
+func (i *Item) UnmarshalJSON(data []byte) error {
+	var title string
+	if err := json.Unmarshal(data, &title); err == nil {
+		*i = Item{Title: title, Quantity: 1}
+		return nil
+	}
+	type item Item
+	aux := item{Quantity: 1}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	*i = Item(aux)
+	return nil
+}
+
+// Total is the price of all of them
+func (i Item) Total() Money { return i.UnitPrice * Money(i.Quantity) }
+
 type Order struct {
-	ID     string   `json:"id"`
-	Href   string   `json:"href"`
-	Items  []string `json:"items"`
-	Price  float64  `json:"price"`
-	Charge Charge   `json:"charge"`
+	ID    string `json:"id"`
+	Href  string `json:"href"`
+	Items []Item `json:"items"`
+	Price Money  `json:"price"`
+	// Charges are the card transactions that paid for this order. Amazon
+	// bills split shipments separately, so there may be several.
+	Charges []Charge `json:"charges"`
+	// Matches are the YNAB transactions approved against this order
+	Matches []Match `json:"matches,omitempty"`
+}
+
+// UnmarshalJSON also accepts the single "charge" field older versions of the
+// bookmarklet send.
+func (o *Order) UnmarshalJSON(data []byte) error {
+	type order Order
+	aux := struct {
+		*order
+		Charge *Charge `json:"charge"`
+	}{order: (*order)(o)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.Charge != nil {
+		o.Charges = append(o.Charges, *aux.Charge)
+	}
+	return nil
+}
+
+// SaveResult is the outcome of saving one order of a batch
+type SaveResult struct {
+	ID      string
+	Created bool
+	Err     error
+}
+
+// OrderCharge is one charge along with the order it paid for.
+type OrderCharge struct {
+	Order
+	Charge Charge
+}
+
+// HighlightStart and HighlightEnd surround the parts of a search result that
+// matched the query.
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// SearchResult is an order found by Search.
+type SearchResult struct {
+	Order
+	// Highlights maps item titles that matched a text search to the same
+	// title with the matching terms marked with HighlightStart and
+	// HighlightEnd.
+	Highlights map[string]string `json:"-"`
+}
+
+// HighlightedItems returns the order's items, with any highlights applied to
+// their titles.
+func (r SearchResult) HighlightedItems() []Item {
+	items := make([]Item, len(r.Items))
+	for i, item := range r.Items {
+		if h, ok := r.Highlights[item.Title]; ok {
+			item.Title = h
+		}
+		items[i] = item
+	}
+	return items
 }
 
 type TransactionID string
@@ -43,9 +172,17 @@ func (b BudgetID) String() string { return string(b) }
 
 type UnapprovedTransaction struct {
 	ID     TransactionID
-	Amount float64
+	Amount Money
 	Date   time.Time
 	Payee  string
+	Memo   string
+	// Account is the name of the YNAB account, which may include the last
+	// four digits of the card
+	Account string
+	// PayeeName and CategoryID are what YNAB has now. Payee prefers the name
+	// from the bank import.
+	PayeeName  string
+	CategoryID CategoryID
 }
 
 type Category struct {
@@ -59,8 +196,93 @@ type Budget struct {
 	LastModified time.Time
 }
 
+// Match records that a YNAB transaction was approved as paying for an order.
+// When the order's items were split between categories, CategoryID is empty
+// and CategoryName lists them, like "Split (Groceries, Home)".
+type Match struct {
+	OrderID       string        `json:"orderId"`
+	TransactionID TransactionID `json:"transactionId"`
+	BudgetID      BudgetID      `json:"budgetId"`
+	CategoryID    CategoryID    `json:"categoryId"`
+	CategoryName  string        `json:"categoryName"`
+	Payee         string        `json:"payee"`
+	ApprovedAt    time.Time     `json:"approvedAt"`
+}
+
+// Rule picks the category, and maybe the payee, for YNAB transactions that
+// match all of its conditions. Empty patterns and zero amounts always match.
+type Rule struct {
+	ID       int64
+	BudgetID BudgetID
+	// TitlePattern is a regular expression matched against the titles of the
+	// items in the order the transaction paid for
+	TitlePattern string
+	// Card is part of the card name on the order's charge, like "1234"
+	Card string
+	// MinAmount and MaxAmount bound the size of the transaction, ignoring
+	// its sign
+	MinAmount Money
+	MaxAmount Money
+	// PayeePattern is a regular expression matched against the payee
+	PayeePattern string
+
+	CategoryID   CategoryID
+	CategoryName string
+	// PayeeName replaces the transaction's payee, if set
+	PayeeName string
+	CreatedAt time.Time
+}
+
+// AutoApproval is a transaction that was approved without anyone looking at
+// it, because it clearly paid for one order and its category was clear.
+type AutoApproval struct {
+	ID       int64
+	BudgetID BudgetID
+	// Transaction is how it was before approval, so it can be undone
+	Transaction  UnapprovedTransaction
+	OrderID      string
+	CategoryID   CategoryID
+	CategoryName string
+	Payee        string
+	// Reason explains where the category came from
+	Reason string
+	// Score is how well the order matched the transaction
+	Score      float64
+	ApprovedAt time.Time
+	UndoneAt   time.Time // zero if it hasn't been undone
+}
+
 type TransactionUpdate struct {
 	Payee        string
 	CategoryID   CategoryID
 	CategoryName string
+	// Splits divide the transaction between several categories, instead of
+	// CategoryID. Their amounts add up to the transaction's.
+	Splits []Split
+	// Orders are the orders the transaction paid for, if we know them, to
+	// write into the memo. Usually there's one, but Amazon sometimes bills
+	// several orders together.
+	Orders []Order
+	// Memo is the transaction's memo before this update
+	Memo string
+}
+
+// APIToken is a credential for the REST API. The secret itself is only shown
+// once, when it's created.
+type APIToken struct {
+	ID         int64
+	Name       string
+	CreatedAt  time.Time
+	LastUsedAt time.Time // zero if never used
+}
+
+// InvoiceSnapshot is an invoice page as it was uploaded, along with what the
+// bookmarklet knew about the order from the transactions page.
+type InvoiceSnapshot struct {
+	ID         int64
+	OrderID    string
+	Href       string
+	Charges    []Charge
+	HTML       string
+	ReceivedAt time.Time
 }
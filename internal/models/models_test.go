@@ -0,0 +1,55 @@
+package models
+
+import "testing"
+
+func TestChargeSame(t *testing.T) {
+	charge := Charge{Card: "Visa ending in 1234", Amount: -17260, Date: "January 3, 2024"}
+	tests := []struct {
+		name  string
+		other Charge
+		want  bool
+	}{
+		{"identical", charge, true},
+		{"transactions page", Charge{Card: "Visa ****1234", Amount: -17260, Date: "January 3, 2024"}, true},
+		{"order history", Charge{Card: "Visa - 1234", Amount: -17260, Date: "January 3, 2024"}, true},
+		{"just the digits", Charge{Card: "1234", Amount: -17260, Date: "January 3, 2024"}, true},
+		{"date written differently", Charge{Card: "Visa ending in 1234", Amount: -17260, Date: "January 03, 2024"}, true},
+		{"another card", Charge{Card: "Visa ****5678", Amount: -17260, Date: "January 3, 2024"}, false},
+		{"another amount", Charge{Card: "Visa ****1234", Amount: -17250, Date: "January 3, 2024"}, false},
+		{"refund", Charge{Card: "Visa ****1234", Amount: 17260, Date: "January 3, 2024"}, false},
+		{"another day", Charge{Card: "Visa ****1234", Amount: -17260, Date: "January 4, 2024"}, false},
+		{"no digits", Charge{Card: "Gift Card", Amount: -17260, Date: "January 3, 2024"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := charge.Same(tt.other); got != tt.want {
+				t.Errorf("Same(%+v) = %v, want %v", tt.other, got, tt.want)
+			}
+			if got := tt.other.Same(charge); got != tt.want {
+				t.Errorf("reversed Same(%+v) = %v, want %v", tt.other, got, tt.want)
+			}
+		})
+	}
+
+	giftCard := Charge{Card: "Gift Card", Amount: -500, Date: "January 3, 2024"}
+	if !giftCard.Same(Charge{Card: "gift card ", Amount: -500, Date: "January 3, 2024"}) {
+		t.Error("gift cards differing in case aren't the same")
+	}
+}
+
+func TestChargeLastFour(t *testing.T) {
+	tests := map[string]string{
+		"Visa ending in 1234":     "1234",
+		"Visa ****1234":           "1234",
+		"Visa - 1234":             "1234",
+		"Mastercard (5678)":       "5678",
+		"Gift Card":               "",
+		"Visa ending in 12345":    "",
+		"Store Card 1234 rewards": "1234",
+	}
+	for card, want := range tests {
+		if got := (Charge{Card: card}).LastFour(); got != want {
+			t.Errorf("LastFour(%q) = %q, want %q", card, got, want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of currency in milliunits, the same representation YNAB
+// uses: $12.34 is Money(12340). Integer milliunits compare exactly, unlike the
+// floats we get from scraping.
+type Money int64
+
+// MoneyFromFloat converts a decimal amount like 12.34 into milliunits,
+// rounding away any float noise past the third decimal place.
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * 1000))
+}
+
+// ParseMoney parses a decimal amount like "12.34", "$1,234.5" or "-0.99".
+func ParseMoney(input string) (Money, error) {
+	s := strings.TrimSpace(input)
+	s = strings.ReplaceAll(s, ",", "")
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	s = strings.TrimPrefix(s, "$")
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || strings.HasPrefix(s, "-") {
+		return 0, fmt.Errorf("invalid amount %q", input)
+	}
+	m := MoneyFromFloat(f)
+	if neg {
+		m = -m
+	}
+	return m, nil
+}
+
+func (m Money) Float() float64 { return float64(m) / 1000 }
+
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// String formats the amount with two decimal places, e.g. "-12.34"
+func (m Money) String() string {
+	return strconv.FormatFloat(m.Float(), 'f', 2, 64)
+}
+
+// MarshalJSON writes a plain JSON number like 12.34, so the wire format is
+// the same as when we used float64.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatFloat(m.Float(), 'f', -1, 64)), nil
+}
+
+// UnmarshalJSON reads a JSON number. null is an error rather than zero, since
+// that's what JSON.stringify makes of NaN when scraping goes wrong.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	f, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return fmt.Errorf("amount must be a finite number, got %s", data)
+	}
+	*m = MoneyFromFloat(f)
+	return nil
+}
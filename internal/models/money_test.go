@@ -0,0 +1,126 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Money
+		wantErr bool
+	}{
+		{input: "12.34", want: 12340},
+		{input: "$12.34", want: 12340},
+		{input: "$1,234.56", want: 1234560},
+		{input: "1234.5", want: 1234500},
+		{input: " 12.34 ", want: 12340},
+		{input: "-0.99", want: -990},
+		{input: "-$12.34", want: -12340},
+		{input: "+12.34", want: 12340},
+		{input: "0", want: 0},
+		{input: "0.1", want: 100},
+		{input: "19.999", want: 19999},
+		{input: "", wantErr: true},
+		{input: "$", wantErr: true},
+		{input: "twelve", wantErr: true},
+		{input: "12.34 USD", wantErr: true},
+		{input: "--12.34", wantErr: true},
+		{input: "$-12.34", wantErr: true},
+		{input: "NaN", wantErr: true},
+		{input: "Inf", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseMoney(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseMoney(%q) = %d, want an error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMoney(%q) error = %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := map[Money]string{
+		12340:  "12.34",
+		-12340: "-12.34",
+		500:    "0.50",
+		0:      "0.00",
+	}
+	for m, want := range tests {
+		if got := m.String(); got != want {
+			t.Errorf("Money(%d).String() = %q, want %q", m, got, want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		m    Money
+		json string
+	}{
+		{12340, "12.34"},
+		{-12340, "-12.34"},
+		{1234560, "1234.56"},
+		{19999, "19.999"},
+		{500, "0.5"},
+		{0, "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			b, err := json.Marshal(tt.m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.json {
+				t.Errorf("Marshal(%d) = %s, want %s", tt.m, b, tt.json)
+			}
+			var got Money
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.m {
+				t.Errorf("round trip of %d = %d", tt.m, got)
+			}
+		})
+	}
+
+	t.Run("float noise", func(t *testing.T) {
+		var got Money
+		if err := json.Unmarshal([]byte("0.30000000000000004"), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != 300 {
+			t.Errorf("Unmarshal = %d, want 300", got)
+		}
+	})
+
+	t.Run("in a struct", func(t *testing.T) {
+		var c Charge
+		if err := json.Unmarshal([]byte(`{"card":"Visa ****1234","amount":-172.6,"date":"January 3, 2024"}`), &c); err != nil {
+			t.Fatal(err)
+		}
+		if c.Amount != -172600 {
+			t.Errorf("amount = %d, want -172600", c.Amount)
+		}
+	})
+
+	for _, bad := range []string{"null", `"12.34"`, "true", "{}"} {
+		t.Run("rejects "+bad, func(t *testing.T) {
+			var got Money
+			if err := json.Unmarshal([]byte(bad), &got); err == nil {
+				t.Errorf("Unmarshal(%s) = %d, want an error", bad, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Revision is one saved change to an order
+type Revision struct {
+	ID        int64         `json:"id"`
+	OrderID   string        `json:"orderId"`
+	RevisedAt time.Time     `json:"revisedAt"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+// FieldChange is one field that differs between two versions of an order. For
+// list fields like items, each added or removed entry is its own change with
+// an empty Old or New.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// String is like "2 x Paper towels @ 12.34 (B000000000)"
+func (i Item) String() string {
+	s := i.Title
+	if i.Quantity != 1 {
+		s = fmt.Sprintf("%d x %s", i.Quantity, s)
+	}
+	if i.UnitPrice != 0 {
+		s += " @ " + i.UnitPrice.String()
+	}
+	if i.ASIN != "" {
+		s += " (" + i.ASIN + ")"
+	}
+	return s
+}
+
+func (c Charge) String() string {
+	return fmt.Sprintf("%s %s %s", c.Date, c.Card, c.Amount)
+}
+
+// Diff lists the changes from old to new. Diffing against the zero Order lists
+// every field of new.
+func Diff(old, new Order) []FieldChange {
+	var changes []FieldChange
+	if old.Href != new.Href {
+		changes = append(changes, FieldChange{"href", old.Href, new.Href})
+	}
+	if old.Price != new.Price {
+		changes = append(changes, FieldChange{"price", old.Price.String(), new.Price.String()})
+	}
+	changes = append(changes, diffList("items", old.Items, new.Items, Item.String)...)
+	changes = append(changes, diffList("charges", old.Charges, new.Charges, Charge.String)...)
+	return changes
+}
+
+// diffList reports what was removed from and added to a list. Duplicates are
+// counted, so a second identical charge shows up as added.
+func diffList[T comparable](field string, old, new []T, str func(T) string) []FieldChange {
+	var changes []FieldChange
+	added := slices.Clone(new)
+	for _, o := range old {
+		if i := slices.Index(added, o); i >= 0 {
+			added = slices.Delete(added, i, i+1)
+		} else {
+			changes = append(changes, FieldChange{Field: field, Old: str(o)})
+		}
+	}
+	for _, n := range added {
+		changes = append(changes, FieldChange{Field: field, New: str(n)})
+	}
+	return changes
+}
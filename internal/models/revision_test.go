@@ -0,0 +1,152 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	coffee := Item{Title: "Coffee", Quantity: 1, UnitPrice: 17260}
+	soap := Item{Title: "Dish Soap", Quantity: 2, UnitPrice: 4990, ASIN: "B000000001"}
+	first := Charge{Card: "Visa ****1234", Amount: -17260, Date: "January 3, 2024"}
+	second := Charge{Card: "Visa ****1234", Amount: -9980, Date: "January 5, 2024"}
+	order := Order{
+		ID:      "111-1234567-1234567",
+		Href:    "https://example.com/order",
+		Items:   []Item{coffee},
+		Price:   17260,
+		Charges: []Charge{first},
+	}
+	with := func(change func(*Order)) Order {
+		o := order
+		o.Items = append([]Item(nil), order.Items...)
+		o.Charges = append([]Charge(nil), order.Charges...)
+		change(&o)
+		return o
+	}
+
+	tests := []struct {
+		name     string
+		old, new Order
+		want     []FieldChange
+	}{
+		{
+			name: "unchanged",
+			old:  order,
+			new:  with(func(o *Order) {}),
+		},
+		{
+			name: "from nothing",
+			new:  order,
+			want: []FieldChange{
+				{Field: "href", New: "https://example.com/order"},
+				{Field: "price", Old: "0.00", New: "17.26"},
+				{Field: "items", New: "Coffee @ 17.26"},
+				{Field: "charges", New: "January 3, 2024 Visa ****1234 -17.26"},
+			},
+		},
+		{
+			name: "href",
+			old:  order,
+			new:  with(func(o *Order) { o.Href = "https://example.com/other" }),
+			want: []FieldChange{{Field: "href", Old: "https://example.com/order", New: "https://example.com/other"}},
+		},
+		{
+			name: "price",
+			old:  order,
+			new:  with(func(o *Order) { o.Price = 27240 }),
+			want: []FieldChange{{Field: "price", Old: "17.26", New: "27.24"}},
+		},
+		{
+			name: "item added",
+			old:  order,
+			new:  with(func(o *Order) { o.Items = append(o.Items, soap) }),
+			want: []FieldChange{{Field: "items", New: "2 x Dish Soap @ 4.99 (B000000001)"}},
+		},
+		{
+			name: "item removed",
+			old:  with(func(o *Order) { o.Items = append(o.Items, soap) }),
+			new:  order,
+			want: []FieldChange{{Field: "items", Old: "2 x Dish Soap @ 4.99 (B000000001)"}},
+		},
+		{
+			name: "item changed",
+			old:  order,
+			new:  with(func(o *Order) { o.Items[0].Quantity = 2 }),
+			want: []FieldChange{
+				{Field: "items", Old: "Coffee @ 17.26"},
+				{Field: "items", New: "2 x Coffee @ 17.26"},
+			},
+		},
+		{
+			name: "items reordered",
+			old:  with(func(o *Order) { o.Items = []Item{coffee, soap} }),
+			new:  with(func(o *Order) { o.Items = []Item{soap, coffee} }),
+		},
+		{
+			name: "duplicate item added",
+			old:  order,
+			new:  with(func(o *Order) { o.Items = append(o.Items, coffee) }),
+			want: []FieldChange{{Field: "items", New: "Coffee @ 17.26"}},
+		},
+		{
+			name: "duplicate item removed",
+			old:  with(func(o *Order) { o.Items = []Item{coffee, coffee, coffee} }),
+			new:  with(func(o *Order) { o.Items = []Item{coffee, coffee} }),
+			want: []FieldChange{{Field: "items", Old: "Coffee @ 17.26"}},
+		},
+		{
+			name: "charge added",
+			old:  order,
+			new:  with(func(o *Order) { o.Charges = append(o.Charges, second) }),
+			want: []FieldChange{{Field: "charges", New: "January 5, 2024 Visa ****1234 -9.98"}},
+		},
+		{
+			name: "charge removed",
+			old:  with(func(o *Order) { o.Charges = append(o.Charges, second) }),
+			new:  order,
+			want: []FieldChange{{Field: "charges", Old: "January 5, 2024 Visa ****1234 -9.98"}},
+		},
+		{
+			name: "second identical charge",
+			old:  order,
+			new:  with(func(o *Order) { o.Charges = append(o.Charges, first) }),
+			want: []FieldChange{{Field: "charges", New: "January 3, 2024 Visa ****1234 -17.26"}},
+		},
+		{
+			name: "identical charges counted",
+			old:  with(func(o *Order) { o.Charges = []Charge{first, first, second} }),
+			new:  with(func(o *Order) { o.Charges = []Charge{second, first, second} }),
+			want: []FieldChange{
+				{Field: "charges", Old: "January 3, 2024 Visa ****1234 -17.26"},
+				{Field: "charges", New: "January 5, 2024 Visa ****1234 -9.98"},
+			},
+		},
+		{
+			name: "everything",
+			old:  order,
+			new: Order{
+				ID:      order.ID,
+				Href:    "https://example.com/other",
+				Items:   []Item{soap},
+				Price:   9980,
+				Charges: []Charge{second},
+			},
+			want: []FieldChange{
+				{Field: "href", Old: "https://example.com/order", New: "https://example.com/other"},
+				{Field: "price", Old: "17.26", New: "9.98"},
+				{Field: "items", Old: "Coffee @ 17.26"},
+				{Field: "items", New: "2 x Dish Soap @ 4.99 (B000000001)"},
+				{Field: "charges", Old: "January 3, 2024 Visa ****1234 -17.26"},
+				{Field: "charges", New: "January 5, 2024 Visa ****1234 -9.98"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
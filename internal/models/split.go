@@ -0,0 +1,91 @@
+package models
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Split is the part of a transaction that goes to one category
+type Split struct {
+	CategoryID   CategoryID
+	CategoryName string
+	Amount       Money
+}
+
+// Allocate divides total in proportion to weights, so that the parts add up to
+// exactly total. The milliunits left over from rounding down go to the parts
+// with the largest remainders. If every weight is zero, the parts are equal.
+func Allocate(total Money, weights []Money) []Money {
+	parts := make([]Money, len(weights))
+	if len(weights) == 0 {
+		return parts
+	}
+
+	var sum int64
+	for _, w := range weights {
+		sum += int64(w.Abs())
+	}
+	equal := sum == 0
+	if equal {
+		sum = int64(len(weights))
+	}
+	weight := func(i int) int64 {
+		if equal {
+			return 1
+		}
+		return int64(weights[i].Abs())
+	}
+
+	abs := int64(total.Abs())
+	remainders := make([]int64, len(weights))
+	var allocated int64
+	for i := range weights {
+		parts[i] = Money(abs * weight(i) / sum)
+		remainders[i] = abs * weight(i) % sum
+		allocated += int64(parts[i])
+	}
+
+	// hand out what's left, biggest remainder first, ties to the earlier part
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return cmp.Compare(remainders[b], remainders[a]) })
+	for _, i := range order[:abs-allocated] {
+		parts[i]++
+	}
+
+	if total < 0 {
+		for i := range parts {
+			parts[i] = -parts[i]
+		}
+	}
+	return parts
+}
+
+// SplitItems divides a transaction's amount between the categories of an
+// order's items, in proportion to the item prices. That spreads tax and
+// shipping across the categories, and the splits add up to exactly amount.
+// categories[i] is the category of items[i]; items in the same category are
+// combined into one split. Items without a price, like those saved before
+// prices were recorded, get no share when other items have one, and splits
+// that come to nothing are left out.
+func SplitItems(amount Money, items []Item, categories []Category) []Split {
+	weights := make([]Money, len(items))
+	for i, item := range items {
+		weights[i] = item.Total()
+	}
+	parts := Allocate(amount, weights)
+
+	var splits []Split
+	for i, part := range parts {
+		c := categories[i]
+		j := slices.IndexFunc(splits, func(s Split) bool { return s.CategoryID == c.ID })
+		if j < 0 {
+			splits = append(splits, Split{CategoryID: c.ID, CategoryName: c.Name})
+			j = len(splits) - 1
+		}
+		splits[j].Amount += part
+	}
+	return slices.DeleteFunc(splits, func(s Split) bool { return s.Amount == 0 })
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   Money
+		weights []Money
+		want    []Money
+	}{
+		{"proportional", -30000, []Money{10000, 20000}, []Money{-10000, -20000}},
+		{"positive total", 30000, []Money{10000, 20000}, []Money{10000, 20000}},
+		{"remainder to the largest remainder", -10000, []Money{1000, 1000, 1000}, []Money{-3334, -3333, -3333}},
+		{"remainder ties go to the earlier part", -3333, []Money{5000, 5000}, []Money{-1667, -1666}},
+		{"uneven remainders", -1000, []Money{1, 2, 4}, []Money{-143, -286, -571}},
+		{"negative weights count by size", -30000, []Money{-10000, -20000}, []Money{-10000, -20000}},
+		{"zero weight gets nothing", -10000, []Money{0, 5000, 5000}, []Money{0, -5000, -5000}},
+		{"all zero weights are equal", -10000, []Money{0, 0, 0}, []Money{-3334, -3333, -3333}},
+		{"one part", -12345, []Money{999}, []Money{-12345}},
+		{"zero total", 0, []Money{1000, 2000}, []Money{0, 0}},
+		{"no parts", -10000, nil, []Money{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Allocate(tt.total, tt.weights)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Allocate(%d, %v) = %v, want %v", tt.total, tt.weights, got, tt.want)
+			}
+			if len(tt.weights) == 0 {
+				return
+			}
+			var sum Money
+			for _, part := range got {
+				sum += part
+			}
+			if sum != tt.total {
+				t.Errorf("parts add up to %d, want %d", sum, tt.total)
+			}
+		})
+	}
+}
+
+func TestSplitItems(t *testing.T) {
+	x := Category{ID: "x", Name: "X"}
+	y := Category{ID: "y", Name: "Y"}
+	item := func(price Money, quantity int) Item {
+		return Item{Title: "thing", Quantity: quantity, UnitPrice: price}
+	}
+	tests := []struct {
+		name       string
+		amount     Money
+		items      []Item
+		categories []Category
+		want       []Split
+	}{
+		{
+			name:       "by price",
+			amount:     -33000,
+			items:      []Item{item(10000, 1), item(20000, 1)},
+			categories: []Category{x, y},
+			want:       []Split{{"x", "X", -11000}, {"y", "Y", -22000}},
+		},
+		{
+			name:       "quantity counts",
+			amount:     -30000,
+			items:      []Item{item(5000, 2), item(20000, 1)},
+			categories: []Category{x, y},
+			want:       []Split{{"x", "X", -10000}, {"y", "Y", -20000}},
+		},
+		{
+			name:       "same category combines",
+			amount:     -3333,
+			items:      []Item{item(1000, 1), item(1000, 1)},
+			categories: []Category{x, x},
+			want:       []Split{{"x", "X", -3333}},
+		},
+		{
+			name:       "rounding stays exact",
+			amount:     -10000,
+			items:      []Item{item(1000, 1), item(1000, 1), item(1000, 1)},
+			categories: []Category{x, y, x},
+			want:       []Split{{"x", "X", -6667}, {"y", "Y", -3333}},
+		},
+		{
+			name:       "refund",
+			amount:     30000,
+			items:      []Item{item(10000, 1), item(20000, 1)},
+			categories: []Category{x, y},
+			want:       []Split{{"x", "X", 10000}, {"y", "Y", 20000}},
+		},
+		{
+			name:       "no prices share equally",
+			amount:     -10000,
+			items:      []Item{item(0, 1), item(0, 1)},
+			categories: []Category{x, y},
+			want:       []Split{{"x", "X", -5000}, {"y", "Y", -5000}},
+		},
+		{
+			name:       "unpriced items are left out",
+			amount:     -10000,
+			items:      []Item{item(0, 1), item(4000, 1)},
+			categories: []Category{x, y},
+			want:       []Split{{"y", "Y", -10000}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitItems(tt.amount, tt.items, tt.categories)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("SplitItems() = %+v, want %+v", got, tt.want)
+			}
+			var sum Money
+			for _, split := range got {
+				sum += split.Amount
+			}
+			if sum != tt.amount {
+				t.Errorf("splits add up to %d, want %d", sum, tt.amount)
+			}
+		})
+	}
+}
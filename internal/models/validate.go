@@ -0,0 +1,78 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// orderID matches Amazon order numbers like 111-1234567-1234567, and digital
+// orders like D01-1234567-1234567
+var orderID = regexp.MustCompile(`^(\d{3}|D\d{2})-\d{7}-\d{7}$`)
+
+// ValidOrderID reports whether id looks like an Amazon order number
+func ValidOrderID(id string) bool {
+	return orderID.MatchString(id)
+}
+
+// FieldError is a problem with one field of an order. Field is a JSON path
+// like "charges[0].date".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists everything wrong with an order
+type ValidationError []FieldError
+
+func (v ValidationError) Error() string {
+	msgs := make([]string, len(v))
+	for i, fe := range v {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return "invalid order: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks the order is something we'd want to store, returning a
+// ValidationError if not.
+func (o Order) Validate() error {
+	var errs ValidationError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, FieldError{field, fmt.Sprintf(format, args...)})
+	}
+
+	if !ValidOrderID(o.ID) {
+		add("id", "%q is not an order number like 111-1234567-1234567", o.ID)
+	}
+	if o.Price < 0 {
+		add("price", "must not be negative, got %s", o.Price)
+	}
+	if len(o.Items) == 0 {
+		add("items", "must list at least one item")
+	}
+	for i, item := range o.Items {
+		if strings.TrimSpace(item.Title) == "" {
+			add(fmt.Sprintf("items[%d].title", i), "must not be blank")
+		}
+		if item.Quantity < 1 {
+			add(fmt.Sprintf("items[%d].quantity", i), "must be at least 1, got %d", item.Quantity)
+		}
+		if item.UnitPrice < 0 {
+			add(fmt.Sprintf("items[%d].unitPrice", i), "must not be negative, got %s", item.UnitPrice)
+		}
+	}
+	// the charge dates are the only dates an order has, and matching needs one
+	if len(o.Charges) == 0 {
+		add("charges", "must list at least one charge, with the date it was billed")
+	}
+	for i, c := range o.Charges {
+		if _, err := c.Time(); err != nil {
+			add(fmt.Sprintf("charges[%d].date", i), "%q is not a date like %q", c.Date, ChargeDateLayout)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
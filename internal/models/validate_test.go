@@ -0,0 +1,61 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := func() Order {
+		return Order{
+			ID:      "111-1234567-1234567",
+			Items:   []Item{{Title: "Coffee", Quantity: 1, UnitPrice: 12340}},
+			Price:   12340,
+			Charges: []Charge{{Card: "Visa ending in 1234", Amount: -12340, Date: "January 2, 2024"}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(*Order)
+		// fields are the fields reported, nil if the order is valid
+		fields []string
+	}{
+		{"valid", func(*Order) {}, nil},
+		{"digital order", func(o *Order) { o.ID = "D01-1234567-1234567" }, nil},
+		{"bad ID", func(o *Order) { o.ID = "123" }, []string{"id"}},
+		{"negative price", func(o *Order) { o.Price = -1 }, []string{"price"}},
+		{"no items", func(o *Order) { o.Items = nil }, []string{"items"}},
+		{"blank title", func(o *Order) { o.Items[0].Title = " " }, []string{"items[0].title"}},
+		{"no quantity", func(o *Order) { o.Items[0].Quantity = 0 }, []string{"items[0].quantity"}},
+		{"no charges", func(o *Order) { o.Charges = nil }, []string{"charges"}},
+		{"no charge date", func(o *Order) { o.Charges[0].Date = "" }, []string{"charges[0].date"}},
+		{"bad charge date", func(o *Order) { o.Charges[0].Date = "2024-01-02" }, []string{"charges[0].date"}},
+		{"several problems", func(o *Order) { o.ID = ""; o.Items = nil; o.Charges = nil }, []string{"id", "items", "charges"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := valid()
+			tt.change(&o)
+			err := o.Validate()
+			if tt.fields == nil {
+				if err != nil {
+					t.Fatalf("Validate() = %v", err)
+				}
+				return
+			}
+			var invalid ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("Validate() = %v, want a ValidationError", err)
+			}
+			var fields []string
+			for _, fe := range invalid {
+				fields = append(fields, fe.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("Validate() = %v, want errors for %v", err, tt.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+// Package orderhistory reads the Retail.OrderHistory CSV files from Amazon's
+// "Request Your Data" export. They have a row per item shipped, so an order
+// with several items or shipments spans several rows.
+package orderhistory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// the columns we use; the export has many more
+const (
+	colOrderID     = "Order ID"
+	colOrderDate   = "Order Date"
+	colTotalOwed   = "Total Owed"
+	colPayment     = "Payment Instrument Type"
+	colOrderStatus = "Order Status"
+	colShipDate    = "Ship Date"
+	colProductName = "Product Name"
+	colASIN        = "ASIN"
+	colQuantity    = "Quantity"
+	colUnitPrice   = "Unit Price"
+)
+
+// notAvailable is what the export has in columns it doesn't know
+const notAvailable = "Not Available"
+
+// Parse reads a Retail.OrderHistory CSV into orders, in the order they first
+// appear. Each shipment becomes a charge on its ship date, which is when
+// Amazon bills the card. Cancelled items are skipped.
+func Parse(r io.Reader) ([]models.Order, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, name := range []string{colOrderID, colProductName, colTotalOwed} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("not an order history file: no %q column", name)
+		}
+	}
+
+	var (
+		orders []*models.Order
+		byID   = map[string]*models.Order{}
+	)
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		get := func(col string) string {
+			if i, ok := cols[col]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		if strings.EqualFold(get(colOrderStatus), "Cancelled") {
+			continue
+		}
+		id := get(colOrderID)
+		owed, err := parseMoney(get(colTotalOwed))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", line, colTotalOwed, err)
+		}
+		item := models.Item{Title: get(colProductName), ASIN: get(colASIN), Quantity: 1}
+		if item.UnitPrice, err = parseMoney(get(colUnitPrice)); err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", line, colUnitPrice, err)
+		}
+		if q, err := strconv.Atoi(get(colQuantity)); err == nil && q > 0 {
+			item.Quantity = q
+		}
+		if item.ASIN != "" {
+			item.URL = "https://www.amazon.com/dp/" + item.ASIN
+		}
+		date, err := parseDate(get(colShipDate))
+		if err != nil || date.IsZero() {
+			date, err = parseDate(get(colOrderDate))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", line, colOrderDate, err)
+		}
+
+		o, ok := byID[id]
+		if !ok {
+			o = &models.Order{
+				ID:   id,
+				Href: "https://www.amazon.com/gp/css/summary/print.html?orderID=" + id,
+			}
+			byID[id] = o
+			orders = append(orders, o)
+		}
+		o.Items = append(o.Items, item)
+		o.Price += owed
+		if !date.IsZero() {
+			addCharge(o, card(get(colPayment)), owed, date)
+		}
+	}
+
+	out := make([]models.Order, len(orders))
+	for i, o := range orders {
+		out[i] = *o
+	}
+	return out, nil
+}
+
+// addCharge adds the row's amount to the charge for its shipment. Charges are
+// negative, like on the transactions page.
+func addCharge(o *models.Order, card string, amount models.Money, date time.Time) {
+	display := date.Format(models.ChargeDateLayout)
+	for i, c := range o.Charges {
+		if c.Card == card && c.Date == display {
+			o.Charges[i].Amount -= amount
+			return
+		}
+	}
+	o.Charges = append(o.Charges, models.Charge{Card: card, Amount: -amount, Date: display})
+}
+
+var cardPattern = regexp.MustCompile(`^(.+?) - (\d{4})\b`)
+
+// card converts payment instruments like "Visa - 1234" to how the
+// transactions page shows them, "Visa ending in 1234"
+func card(instrument string) string {
+	if m := cardPattern.FindStringSubmatch(instrument); m != nil {
+		return m[1] + " ending in " + m[2]
+	}
+	return instrument
+}
+
+func parseMoney(s string) (models.Money, error) {
+	s = strings.Trim(s, "'")
+	if s == "" || s == notAvailable {
+		return 0, nil
+	}
+	return models.ParseMoney(s)
+}
+
+// parseDate reads the timestamps in newer exports and the dates in older
+// ones. Missing dates are the zero time.
+func parseDate(s string) (time.Time, error) {
+	if s == "" || s == notAvailable {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("01/02/2006", s)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %q", s)
+	}
+	return t, nil
+}
+
+// Merge combines an imported order with the one already saved, if any. What
+// the bookmarklet scraped wins, since it's what the invoice and transactions
+// page say; the import only fills in what's missing, like item ASINs and
+// prices.
+func Merge(existing, imported models.Order) models.Order {
+	if existing.ID == "" {
+		return imported
+	}
+	merged := existing
+	if merged.Href == "" {
+		merged.Href = imported.Href
+	}
+	if len(merged.Items) == 0 {
+		merged.Items = imported.Items
+	} else {
+		merged.Items = slices.Clone(merged.Items)
+		for i, item := range merged.Items {
+			j := slices.IndexFunc(imported.Items, func(im models.Item) bool { return im.Title == item.Title })
+			if j >= 0 {
+				merged.Items[i] = fillItem(item, imported.Items[j])
+			}
+		}
+	}
+	if merged.Price == 0 {
+		merged.Price = imported.Price
+	}
+	if len(merged.Charges) == 0 {
+		merged.Charges = imported.Charges
+	}
+	return merged
+}
+
+// fillItem adds the details the export has to an item the bookmarklet found
+func fillItem(item, imported models.Item) models.Item {
+	if item.ASIN == "" {
+		item.ASIN = imported.ASIN
+	}
+	if item.URL == "" {
+		item.URL = imported.URL
+	}
+	if item.UnitPrice == 0 {
+		item.UnitPrice = imported.UnitPrice
+		item.Quantity = imported.Quantity
+	}
+	return item
+}
+
+// Store is where Import saves orders
+type Store interface {
+	Load(ctx context.Context, id string) (models.Order, error)
+	SaveBatch(context.Context, []models.Order) ([]models.SaveResult, error)
+}
+
+// Import parses an order history file and saves the orders, merged with any
+// that were already saved. Invalid orders are reported in the results rather
+// than saved.
+func Import(ctx context.Context, s Store, r io.Reader) ([]models.SaveResult, error) {
+	orders, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]models.SaveResult, len(orders))
+	valid := make([]models.Order, 0, len(orders))
+	validIdx := make([]int, 0, len(orders))
+	for i, o := range orders {
+		existing, err := s.Load(ctx, o.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		o = Merge(existing, o)
+		if err := o.Validate(); err != nil {
+			results[i] = models.SaveResult{ID: o.ID, Err: err}
+			continue
+		}
+		valid = append(valid, o)
+		validIdx = append(validIdx, i)
+	}
+
+	saved, err := s.SaveBatch(ctx, valid)
+	if err != nil {
+		return nil, err
+	}
+	for j, res := range saved {
+		results[validIdx[j]] = res
+	}
+	return results, nil
+}
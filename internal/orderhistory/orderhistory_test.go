@@ -0,0 +1,216 @@
+package orderhistory
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+func href(id string) string {
+	return "https://www.amazon.com/gp/css/summary/print.html?orderID=" + id
+}
+
+// parsed is what Parse reads from testdata/Retail.OrderHistory.1.csv
+var parsed = []models.Order{
+	{
+		ID:   "111-0000001-0000001",
+		Href: href("111-0000001-0000001"),
+		Items: []models.Item{
+			{Title: "Ground Coffee, Medium Roast, 12 Ounce", ASIN: "B000000001", URL: "https://www.amazon.com/dp/B000000001", Quantity: 2, UnitPrice: 11990},
+			{Title: "Dish Soap, Lemon, 3 Pack", ASIN: "B000000002", URL: "https://www.amazon.com/dp/B000000002", Quantity: 1, UnitPrice: 6500},
+		},
+		Price: 33020,
+		// shipped together, so billed together
+		Charges: []models.Charge{{Card: "Visa ending in 1234", Amount: -33020, Date: "January 3, 2024"}},
+	},
+	{
+		ID:   "111-0000002-0000002",
+		Href: href("111-0000002-0000002"),
+		// the bath towels were cancelled
+		Items: []models.Item{
+			{Title: "Paper Towels, 6 Double Rolls", ASIN: "B000000003", URL: "https://www.amazon.com/dp/B000000003", Quantity: 1, UnitPrice: 10000},
+			{Title: "Tea Bags, Green, 100 Count", ASIN: "B000000004", URL: "https://www.amazon.com/dp/B000000004", Quantity: 1, UnitPrice: 5000},
+		},
+		Price: 16200,
+		Charges: []models.Charge{
+			{Card: "Mastercard ending in 5678", Amount: -10800, Date: "February 10, 2024"},
+			{Card: "Mastercard ending in 5678", Amount: -5400, Date: "February 12, 2024"},
+		},
+	},
+	// 111-0000003-0000003 was cancelled altogether
+	{
+		ID:    "111-0000004-0000004",
+		Href:  href("111-0000004-0000004"),
+		Items: []models.Item{{Title: "The Example Novel", ASIN: "B000000007", URL: "https://www.amazon.com/dp/B000000007", Quantity: 1, UnitPrice: 4990}},
+		Price: 4990,
+		// not shipped yet, so it's on the order date
+		Charges: []models.Charge{{Card: "Gift Certificate/Card", Amount: -4990, Date: "March 1, 2024"}},
+	},
+}
+
+func TestParse(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "Retail.OrderHistory.1.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, err := Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, parsed) {
+		t.Errorf("Parse() =\n%+v\nwant\n%+v", got, parsed)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	const header = "Order ID,Order Date,Total Owed,Unit Price,Ship Date,Product Name\n"
+	tests := []struct {
+		name, csv, want string
+	}{
+		{"empty", "", "reading header"},
+		{"another file", "Date,Amount\n2024-01-01,5\n", `no "Order ID" column`},
+		{"bad amount", header + "111-0000001-0000001,2024-01-02T00:00:00Z,lots,1,,Coffee\n", "line 2: Total Owed"},
+		{"bad unit price", header + "111-0000001-0000001,2024-01-02T00:00:00Z,1,lots,,Coffee\n", "line 2: Unit Price"},
+		{"bad date", header + "111-0000001-0000001,yesterday,1,1,,Coffee\n", `line 2: Order Date: invalid date "yesterday"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.csv))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	imported := parsed[0]
+	// what the bookmarklet scraped: no ASINs or prices, but the charge as
+	// the transactions page shows it
+	scraped := models.Order{
+		ID:   imported.ID,
+		Href: "https://www.amazon.com/gp/your-account/order-details?orderID=" + imported.ID,
+		Items: []models.Item{
+			{Title: "Ground Coffee, Medium Roast, 12 Ounce", Quantity: 1},
+			{Title: "Something the export doesn't have", Quantity: 1},
+		},
+		Price:   33020,
+		Charges: []models.Charge{{Card: "Visa ****1234", Amount: -33020, Date: "January 3, 2024"}},
+	}
+
+	tests := []struct {
+		name     string
+		existing models.Order
+		want     models.Order
+	}{
+		{"new order", models.Order{}, imported},
+		{
+			name:     "already scraped",
+			existing: scraped,
+			want: models.Order{
+				ID:   scraped.ID,
+				Href: scraped.Href,
+				Items: []models.Item{
+					{Title: "Ground Coffee, Medium Roast, 12 Ounce", ASIN: "B000000001", URL: "https://www.amazon.com/dp/B000000001", Quantity: 2, UnitPrice: 11990},
+					{Title: "Something the export doesn't have", Quantity: 1},
+				},
+				Price:   scraped.Price,
+				Charges: scraped.Charges,
+			},
+		},
+		{
+			name:     "saved without charges or items",
+			existing: models.Order{ID: imported.ID},
+			want: models.Order{
+				ID:      imported.ID,
+				Href:    imported.Href,
+				Items:   imported.Items,
+				Price:   imported.Price,
+				Charges: imported.Charges,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Merge(tt.existing, imported); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+
+	if scraped.Items[0].ASIN != "" {
+		t.Error("Merge changed the saved order's items")
+	}
+}
+
+// fakeStore has the orders the bookmarklet already saved
+type fakeStore struct {
+	orders map[string]models.Order
+	saved  []models.Order
+}
+
+func (s *fakeStore) Load(_ context.Context, id string) (models.Order, error) {
+	if o, ok := s.orders[id]; ok {
+		return o, nil
+	}
+	return models.Order{}, sql.ErrNoRows
+}
+
+func (s *fakeStore) SaveBatch(_ context.Context, orders []models.Order) ([]models.SaveResult, error) {
+	s.saved = append(s.saved, orders...)
+	results := make([]models.SaveResult, len(orders))
+	for i, o := range orders {
+		_, exists := s.orders[o.ID]
+		results[i] = models.SaveResult{ID: o.ID, Created: !exists}
+	}
+	return results, nil
+}
+
+func TestImport(t *testing.T) {
+	charge := models.Charge{Card: "Mastercard ****5678", Amount: -10800, Date: "February 10, 2024"}
+	s := &fakeStore{orders: map[string]models.Order{
+		"111-0000002-0000002": {
+			ID:      "111-0000002-0000002",
+			Items:   []models.Item{{Title: "Paper Towels, 6 Double Rolls", Quantity: 1}},
+			Price:   10800,
+			Charges: []models.Charge{charge},
+		},
+	}}
+	f, err := os.Open(filepath.Join("testdata", "Retail.OrderHistory.1.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	results, err := Import(context.Background(), s, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created []bool
+	for _, res := range results {
+		if res.Err != nil {
+			t.Errorf("%s: %v", res.ID, res.Err)
+		}
+		created = append(created, res.Created)
+	}
+	if want := []bool{true, false, true}; !reflect.DeepEqual(created, want) {
+		t.Errorf("created = %v, want %v", created, want)
+	}
+
+	// the scraped order keeps its charge, and gets the ASIN
+	merged := s.saved[1]
+	if !reflect.DeepEqual(merged.Charges, []models.Charge{charge}) {
+		t.Errorf("charges = %v, want the scraped one", merged.Charges)
+	}
+	if merged.Items[0].ASIN != "B000000003" {
+		t.Errorf("items = %+v, want the ASIN filled in", merged.Items)
+	}
+}
@@ -0,0 +1,32 @@
+package query
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// parseDateRange recognizes dates in a query, returning the first and last
+// day they cover. It understands a single day ("2024-01-02", "January 2,
+// 2024"), a month ("2024-01", "January 2024"), and two of those joined by "..".
+func parseDateRange(q string) (from, to time.Time, ok bool) {
+	if start, end, found := strings.Cut(q, ".."); found {
+		from, _, ok1 := parseDateRange(strings.TrimSpace(start))
+		_, to, ok2 := parseDateRange(strings.TrimSpace(end))
+		return from, to, ok1 && ok2 && !to.Before(from)
+	}
+
+	q = strings.TrimSpace(q)
+	for _, layout := range []string{time.DateOnly, models.ChargeDateLayout} {
+		if t, err := time.Parse(layout, q); err == nil {
+			return t, t, true
+		}
+	}
+	for _, layout := range []string{"2006-01", "January 2006"} {
+		if t, err := time.Parse(layout, q); err == nil {
+			return t, t.AddDate(0, 1, -1), true
+		}
+	}
+	return from, to, false
+}
@@ -0,0 +1,206 @@
+// Package query parses the search box language, for example:
+//
+//	card:1234 after:2024-01-01 before:2024-06-30 amount:>50 category:Groceries "paper towels"
+//
+// Bare words and quoted phrases search item titles. A bare amount ("12.34" or
+// "$6") or date ("2024-01", "January 2, 2024") is shorthand for amount: or
+// on:. A plain number like "6" is only an amount when it's the whole query,
+// so "usb 6" searches titles.
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// Op is a comparison for amount filters
+type Op string
+
+const (
+	Eq Op = "="
+	Lt Op = "<"
+	Le Op = "<="
+	Gt Op = ">"
+	Ge Op = ">="
+)
+
+// AmountFilter compares an order's price or charge amounts, ignoring sign.
+type AmountFilter struct {
+	Op     Op
+	Amount models.Money
+}
+
+// Query is a parsed search. Zero fields don't filter anything.
+type Query struct {
+	// Card matches part of the card name on any charge, e.g. "1234"
+	Card string
+	// After and Before are inclusive bounds on the charge date
+	After, Before time.Time
+	Amounts       []AmountFilter
+	// Category matches part of the name of the YNAB category
+	Category string
+	// Terms are words and phrases that must each appear in an item title of
+	// the order, not necessarily the same one
+	Terms []string
+
+	// Limit and Offset page through the results. They aren't part of the
+	// query language, a zero Limit means no limit.
+	Limit, Offset int
+}
+
+// IsZero reports whether the query has no filters at all.
+func (q Query) IsZero() bool {
+	return q.Card == "" && q.After.IsZero() && q.Before.IsZero() &&
+		len(q.Amounts) == 0 && q.Category == "" && len(q.Terms) == 0
+}
+
+// SyntaxError describes what's wrong with a query
+type SyntaxError struct {
+	// Pos is the byte offset of the problem in the query
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s (at character %d)", e.Msg, e.Pos+1)
+}
+
+// token is one space-separated part of the query, e.g. `card:1234` or
+// `"paper towels"`
+type token struct {
+	pos    int
+	key    string
+	value  string
+	quoted bool
+}
+
+// Parse reads a query. Errors are always a *SyntaxError.
+func Parse(s string) (Query, error) {
+	var q Query
+	// "January 2, 2024" has spaces, so check for a date before splitting
+	if from, to, ok := parseDateRange(s); ok {
+		return Query{After: from, Before: to}, nil
+	}
+
+	tokens, err := tokenize(s)
+	if err != nil {
+		return q, err
+	}
+
+	for _, t := range tokens {
+		if t.value == "" && t.key == "" {
+			return q, &SyntaxError{t.pos, "empty quotes, put something to search for between them"}
+		}
+		if t.value == "" {
+			return q, &SyntaxError{t.pos, fmt.Sprintf("%s: needs a value", t.key)}
+		}
+		switch t.key {
+		case "":
+			q.addBare(t, len(tokens) == 1)
+		case "card":
+			q.Card = t.value
+		case "category":
+			q.Category = t.value
+		case "after", "before", "on":
+			from, to, ok := parseDateRange(t.value)
+			if !ok {
+				return q, &SyntaxError{t.pos, fmt.Sprintf("%s: %q is not a date like 2024-01-31 or 2024-01", t.key, t.value)}
+			}
+			switch t.key {
+			case "after":
+				q.After = from
+			case "before":
+				q.Before = to
+			default:
+				q.After, q.Before = from, to
+			}
+		case "amount":
+			f, err := parseAmount(t.value)
+			if err != nil {
+				return q, &SyntaxError{t.pos, fmt.Sprintf("amount: %q is not an amount like 12.34 or >50", t.value)}
+			}
+			q.Amounts = append(q.Amounts, f)
+		default:
+			return q, &SyntaxError{t.pos, fmt.Sprintf("unknown filter %q, expected one of card, after, before, on, amount, category", t.key)}
+		}
+	}
+	return q, nil
+}
+
+// addBare handles a token without a key. alone is whether it's the only token.
+func (q *Query) addBare(t token, alone bool) {
+	if !t.quoted {
+		if m, err := models.ParseMoney(t.value); err == nil && (alone || strings.ContainsAny(t.value, "$.")) {
+			q.Amounts = append(q.Amounts, AmountFilter{Eq, m.Abs()})
+			return
+		}
+		if from, to, ok := parseDateRange(t.value); ok {
+			q.After, q.Before = from, to
+			return
+		}
+	}
+	q.Terms = append(q.Terms, t.value)
+}
+
+func parseAmount(s string) (AmountFilter, error) {
+	op := Eq
+	for _, o := range []Op{Le, Ge, Lt, Gt, Eq} {
+		if strings.HasPrefix(s, string(o)) {
+			op = o
+			s = strings.TrimPrefix(s, string(o))
+			break
+		}
+	}
+	m, err := models.ParseMoney(s)
+	return AmountFilter{op, m.Abs()}, err
+}
+
+// tokenize splits the query on spaces, keeping quoted values together, and
+// splits off any "key:" prefix.
+func tokenize(s string) ([]token, error) {
+	var (
+		tokens []token
+		cur    *token
+		sb     strings.Builder
+	)
+	flush := func() {
+		if cur != nil {
+			cur.value = sb.String()
+			tokens = append(tokens, *cur)
+			cur = nil
+			sb.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			if cur == nil {
+				cur = &token{pos: i}
+			}
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, &SyntaxError{i, "unterminated quote"}
+			}
+			sb.WriteString(s[i+1 : i+1+end])
+			cur.quoted = true
+			i += end + 1
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+		case c == ':' && cur != nil && cur.key == "" && !cur.quoted:
+			cur.key = strings.ToLower(sb.String())
+			sb.Reset()
+		default:
+			if cur == nil {
+				cur = &token{pos: i}
+			}
+			sb.WriteByte(c)
+		}
+	}
+	flush()
+	return tokens, nil
+}
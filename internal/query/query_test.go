@@ -0,0 +1,148 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		q    string
+		want Query
+	}{
+		{"", Query{}},
+		{"coffee", Query{Terms: []string{"coffee"}}},
+		{"paper  towels", Query{Terms: []string{"paper", "towels"}}},
+		{`"paper towels"`, Query{Terms: []string{"paper towels"}}},
+		{`usb "type c" cable`, Query{Terms: []string{"usb", "type c", "cable"}}},
+		{"card:1234", Query{Card: "1234"}},
+		{"CARD:1234", Query{Card: "1234"}},
+		{`category:"Home Goods"`, Query{Category: "Home Goods"}},
+		{`category:Home" Goods"`, Query{Category: "Home Goods"}},
+		{`"card:1234"`, Query{Terms: []string{"card:1234"}}},
+
+		// amounts
+		{"amount:12.34", Query{Amounts: []AmountFilter{{Eq, 12340}}}},
+		{"amount:=12.34", Query{Amounts: []AmountFilter{{Eq, 12340}}}},
+		{"amount:-12.34", Query{Amounts: []AmountFilter{{Eq, 12340}}}},
+		{"amount:>50", Query{Amounts: []AmountFilter{{Gt, 50000}}}},
+		{"amount:<50", Query{Amounts: []AmountFilter{{Lt, 50000}}}},
+		{"amount:>=50", Query{Amounts: []AmountFilter{{Ge, 50000}}}},
+		{"amount:<=$1,000", Query{Amounts: []AmountFilter{{Le, 1000000}}}},
+		{"amount:>10 amount:<20", Query{Amounts: []AmountFilter{{Gt, 10000}, {Lt, 20000}}}},
+
+		// bare numbers are amounts when they look like one
+		{"12.34", Query{Amounts: []AmountFilter{{Eq, 12340}}}},
+		{"$6", Query{Amounts: []AmountFilter{{Eq, 6000}}}},
+		{"6", Query{Amounts: []AmountFilter{{Eq, 6000}}}},
+		{"usb 6", Query{Terms: []string{"usb", "6"}}},
+		{"usb $6", Query{Terms: []string{"usb"}, Amounts: []AmountFilter{{Eq, 6000}}}},
+		{"usb 6.00", Query{Terms: []string{"usb"}, Amounts: []AmountFilter{{Eq, 6000}}}},
+		{`"12.34"`, Query{Terms: []string{"12.34"}}},
+
+		// dates
+		{"after:2024-01-02", Query{After: date("2024-01-02")}},
+		{"before:2024-01-02", Query{Before: date("2024-01-02")}},
+		{"after:2024-01", Query{After: date("2024-01-01")}},
+		{"before:2024-02", Query{Before: date("2024-02-29")}},
+		{"on:2024-01-02", Query{After: date("2024-01-02"), Before: date("2024-01-02")}},
+		{"on:2024-01..2024-03", Query{After: date("2024-01-01"), Before: date("2024-03-31")}},
+		{`after:"January 2, 2024"`, Query{After: date("2024-01-02")}},
+		{"2024-01", Query{After: date("2024-01-01"), Before: date("2024-01-31")}},
+		{"January 2, 2024", Query{After: date("2024-01-02"), Before: date("2024-01-02")}},
+		{"January 2024", Query{After: date("2024-01-01"), Before: date("2024-01-31")}},
+		{"2024-01-02..2024-01-05", Query{After: date("2024-01-02"), Before: date("2024-01-05")}},
+		{"coffee 2024-01", Query{Terms: []string{"coffee"}, After: date("2024-01-01"), Before: date("2024-01-31")}},
+
+		{
+			`card:1234 after:2024-01-01 before:2024-06-30 amount:>50 category:Groceries "paper towels"`,
+			Query{
+				Card:     "1234",
+				After:    date("2024-01-01"),
+				Before:   date("2024-06-30"),
+				Amounts:  []AmountFilter{{Gt, 50000}},
+				Category: "Groceries",
+				Terms:    []string{"paper towels"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			got, err := Parse(tt.q)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		q    string
+		want string
+	}{
+		{`"paper towels`, "unterminated quote (at character 1)"},
+		{`coffee category:"Home`, "unterminated quote (at character 17)"},
+		{`""`, "empty quotes, put something to search for between them (at character 1)"},
+		{`coffee ""`, "empty quotes, put something to search for between them (at character 8)"},
+		{"card:", "card: needs a value (at character 1)"},
+		{`coffee category:""`, "category: needs a value (at character 8)"},
+		{"after:soon", `after: "soon" is not a date like 2024-01-31 or 2024-01 (at character 1)`},
+		{"before:2024-13", `before: "2024-13" is not a date like 2024-01-31 or 2024-01 (at character 1)`},
+		{"on:2024-03..2024-01", `on: "2024-03..2024-01" is not a date like 2024-01-31 or 2024-01 (at character 1)`},
+		{"amount:lots", `amount: "lots" is not an amount like 12.34 or >50 (at character 1)`},
+		{"amount:>", `amount: ">" is not an amount like 12.34 or >50 (at character 1)`},
+		{"color:red", `unknown filter "color", expected one of card, after, before, on, amount, category (at character 1)`},
+		{"ratio 16:9", `unknown filter "16", expected one of card, after, before, on, amount, category (at character 7)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			_, err := Parse(tt.q)
+			var syntax *SyntaxError
+			if !errors.As(err, &syntax) {
+				t.Fatalf("Parse() error = %v, want a *SyntaxError", err)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Parse() error = %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []token
+	}{
+		{"", nil},
+		{"  coffee\tbeans\n", []token{{pos: 2, value: "coffee"}, {pos: 9, value: "beans"}}},
+		{`"paper towels" x`, []token{{pos: 0, value: "paper towels", quoted: true}, {pos: 15, value: "x"}}},
+		{`Card:"12 34"`, []token{{pos: 0, key: "card", value: "12 34", quoted: true}}},
+		{"a:b:c", []token{{pos: 0, key: "a", value: "b:c"}}},
+		{`""`, []token{{pos: 0, quoted: true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := tokenize(tt.s)
+			if err != nil {
+				t.Fatalf("tokenize() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenize() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+// Package rules picks categories for YNAB transactions from hand-written
+// rules. A rule matches on the items and card of the order a transaction paid
+// for, the transaction's amount and its payee; the first rule that matches
+// wins.
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// Rule is a models.Rule ready to match
+type Rule struct {
+	models.Rule
+	title, payee *regexp.Regexp
+}
+
+// Compile checks a rule and prepares its patterns. Patterns are case
+// insensitive.
+func Compile(r models.Rule) (*Rule, error) {
+	var errs []error
+	if r.CategoryID == "" {
+		errs = append(errs, errors.New("a category is required"))
+	}
+	if r.TitlePattern == "" && r.Card == "" && r.MinAmount == 0 && r.MaxAmount == 0 && r.PayeePattern == "" {
+		errs = append(errs, errors.New("at least one condition is required"))
+	}
+	if r.MinAmount < 0 || r.MaxAmount < 0 {
+		errs = append(errs, errors.New("amounts must not be negative"))
+	} else if r.MaxAmount != 0 && r.MaxAmount < r.MinAmount {
+		errs = append(errs, errors.New("the maximum amount is less than the minimum"))
+	}
+	compiled := &Rule{Rule: r}
+	var err error
+	if compiled.title, err = compile(r.TitlePattern); err != nil {
+		errs = append(errs, fmt.Errorf("title pattern: %w", err))
+	}
+	if compiled.payee, err = compile(r.PayeePattern); err != nil {
+		errs = append(errs, fmt.Errorf("payee pattern: %w", err))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)" + pattern)
+}
+
+// CompileAll compiles saved rules, in order
+func CompileAll(rules []models.Rule) ([]*Rule, error) {
+	compiled := make([]*Rule, len(rules))
+	for i, r := range rules {
+		c, err := Compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", r.ID, err)
+		}
+		compiled[i] = c
+	}
+	return compiled, nil
+}
+
+// needsOrder reports whether the rule has conditions on the order
+func (r *Rule) needsOrder() bool {
+	return r.title != nil || r.Card != ""
+}
+
+// Match reports whether the rule matches a transaction that paid for o. o is
+// nil if we don't know the order, which only matches rules that don't look at
+// it.
+func (r *Rule) Match(t models.UnapprovedTransaction, o *models.OrderCharge) bool {
+	amount := t.Amount.Abs()
+	if amount < r.MinAmount || (r.MaxAmount != 0 && amount > r.MaxAmount) {
+		return false
+	}
+	if r.payee != nil && !r.payee.MatchString(t.Payee) {
+		return false
+	}
+	if !r.needsOrder() {
+		return true
+	}
+	if o == nil {
+		return false
+	}
+	if r.Card != "" && !strings.Contains(strings.ToLower(o.Charge.Card), strings.ToLower(r.Card)) {
+		return false
+	}
+	if r.title != nil && !r.matchesItem(o.Items) {
+		return false
+	}
+	return true
+}
+
+func (r *Rule) matchesItem(items []models.Item) bool {
+	for _, item := range items {
+		if r.title.MatchString(item.Title) {
+			return true
+		}
+	}
+	return false
+}
+
+// Suggest finds the first rule that matches the transaction with any of its
+// candidate orders, or with none. It returns the order the rule matched, which
+// is nil if the rule didn't need one.
+func Suggest(rules []*Rule, t models.UnapprovedTransaction, orders []models.OrderCharge) (*Rule, *models.OrderCharge) {
+	for _, r := range rules {
+		if !r.needsOrder() {
+			if r.Match(t, nil) {
+				return r, nil
+			}
+			continue
+		}
+		for i := range orders {
+			if r.Match(t, &orders[i]) {
+				return r, &orders[i]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Hit is a past charge that a rule matches
+type Hit struct {
+	models.OrderCharge
+	// Previous is how the charge's transaction was approved, if it was
+	Previous *models.Match
+}
+
+// Preview runs a rule over past charges, to see what it would have done.
+// Charges whose order was approved in YNAB are checked against the payee it
+// was approved with; the rest have no payee.
+func Preview(r *Rule, charges []models.OrderCharge) []Hit {
+	var hits []Hit
+	for _, oc := range charges {
+		var previous *models.Match
+		if len(oc.Matches) > 0 {
+			previous = &oc.Matches[len(oc.Matches)-1]
+		}
+		t := models.UnapprovedTransaction{Amount: oc.Charge.Amount}
+		if previous != nil {
+			t.Payee = previous.Payee
+		}
+		if r.Match(t, &oc) {
+			hits = append(hits, Hit{OrderCharge: oc, Previous: previous})
+		}
+	}
+	return hits
+}
@@ -0,0 +1,294 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// orderCharge is a charge to the given card for an order with the given item
+// titles
+func orderCharge(id, card string, titles ...string) models.OrderCharge {
+	var items []models.Item
+	for _, title := range titles {
+		items = append(items, models.Item{Title: title, Quantity: 1})
+	}
+	return models.OrderCharge{
+		Order:  models.Order{ID: id, Items: items},
+		Charge: models.Charge{Card: card, Amount: -19990, Date: "January 3, 2024"},
+	}
+}
+
+func mustCompile(t *testing.T, r models.Rule) *Rule {
+	t.Helper()
+	if r.CategoryID == "" {
+		r.CategoryID = "c-groceries"
+	}
+	compiled, err := Compile(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compiled
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    models.Rule
+		wantErr bool
+	}{
+		{"title", models.Rule{CategoryID: "c", TitlePattern: "coffee|tea"}, false},
+		{"card", models.Rule{CategoryID: "c", Card: "1234"}, false},
+		{"minimum amount", models.Rule{CategoryID: "c", MinAmount: 1000}, false},
+		{"maximum amount", models.Rule{CategoryID: "c", MaxAmount: 1000}, false},
+		{"amount range", models.Rule{CategoryID: "c", MinAmount: 1000, MaxAmount: 1000}, false},
+		{"payee", models.Rule{CategoryID: "c", PayeePattern: "amazon"}, false},
+		{"no category", models.Rule{TitlePattern: "coffee"}, true},
+		{"no conditions", models.Rule{CategoryID: "c", PayeeName: "Amazon"}, true},
+		{"negative amount", models.Rule{CategoryID: "c", MinAmount: -1000}, true},
+		{"maximum below minimum", models.Rule{CategoryID: "c", MinAmount: 2000, MaxAmount: 1000}, true},
+		{"bad title pattern", models.Rule{CategoryID: "c", TitlePattern: "coffee("}, true},
+		{"bad payee pattern", models.Rule{CategoryID: "c", PayeePattern: "[amazon"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Compile() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	coffee := orderCharge("o1", "Visa ending in 1234", "Ground Coffee, 12 Ounce", "Dish Soap")
+	tests := []struct {
+		name  string
+		rule  models.Rule
+		t     models.UnapprovedTransaction
+		order *models.OrderCharge
+		want  bool
+	}{
+		{
+			name:  "title",
+			rule:  models.Rule{TitlePattern: "coffee"},
+			t:     models.UnapprovedTransaction{Amount: -19990},
+			order: &coffee,
+			want:  true,
+		},
+		{
+			name:  "title matches any item",
+			rule:  models.Rule{TitlePattern: "^dish"},
+			t:     models.UnapprovedTransaction{Amount: -19990},
+			order: &coffee,
+			want:  true,
+		},
+		{
+			name:  "title doesn't match",
+			rule:  models.Rule{TitlePattern: "tea"},
+			t:     models.UnapprovedTransaction{Amount: -19990},
+			order: &coffee,
+			want:  false,
+		},
+		{
+			name: "title without an order",
+			rule: models.Rule{TitlePattern: "coffee"},
+			t:    models.UnapprovedTransaction{Amount: -19990},
+			want: false,
+		},
+		{
+			name:  "card",
+			rule:  models.Rule{Card: "1234"},
+			t:     models.UnapprovedTransaction{Amount: -19990},
+			order: &coffee,
+			want:  true,
+		},
+		{
+			name:  "card ignores case",
+			rule:  models.Rule{Card: "VISA"},
+			t:     models.UnapprovedTransaction{Amount: -19990},
+			order: &coffee,
+			want:  true,
+		},
+		{
+			name:  "another card",
+			rule:  models.Rule{Card: "5678"},
+			t:     models.UnapprovedTransaction{Amount: -19990},
+			order: &coffee,
+			want:  false,
+		},
+		{
+			name: "within the amounts",
+			rule: models.Rule{MinAmount: 10000, MaxAmount: 20000},
+			t:    models.UnapprovedTransaction{Amount: -19990},
+			want: true,
+		},
+		{
+			name: "refunds count by size",
+			rule: models.Rule{MinAmount: 10000, MaxAmount: 20000},
+			t:    models.UnapprovedTransaction{Amount: 19990},
+			want: true,
+		},
+		{
+			name: "on the minimum",
+			rule: models.Rule{MinAmount: 19990},
+			t:    models.UnapprovedTransaction{Amount: -19990},
+			want: true,
+		},
+		{
+			name: "on the maximum",
+			rule: models.Rule{MaxAmount: 19990},
+			t:    models.UnapprovedTransaction{Amount: -19990},
+			want: true,
+		},
+		{
+			name: "below the minimum",
+			rule: models.Rule{MinAmount: 20000},
+			t:    models.UnapprovedTransaction{Amount: -19990},
+			want: false,
+		},
+		{
+			name: "above the maximum",
+			rule: models.Rule{MaxAmount: 10000},
+			t:    models.UnapprovedTransaction{Amount: -19990},
+			want: false,
+		},
+		{
+			name: "payee",
+			rule: models.Rule{PayeePattern: "amazon|amzn"},
+			t:    models.UnapprovedTransaction{Amount: -19990, Payee: "AMZN Mktp US"},
+			want: true,
+		},
+		{
+			name: "another payee",
+			rule: models.Rule{PayeePattern: "amazon|amzn"},
+			t:    models.UnapprovedTransaction{Amount: -19990, Payee: "Target"},
+			want: false,
+		},
+		{
+			name:  "every condition",
+			rule:  models.Rule{TitlePattern: "coffee", Card: "1234", MaxAmount: 20000, PayeePattern: "amazon"},
+			t:     models.UnapprovedTransaction{Amount: -19990, Payee: "Amazon.com"},
+			order: &coffee,
+			want:  true,
+		},
+		{
+			name:  "one condition fails",
+			rule:  models.Rule{TitlePattern: "coffee", Card: "1234", MaxAmount: 10000, PayeePattern: "amazon"},
+			t:     models.UnapprovedTransaction{Amount: -19990, Payee: "Amazon.com"},
+			order: &coffee,
+			want:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustCompile(t, tt.rule).Match(tt.t, tt.order); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	coffee := orderCharge("o1", "Visa ending in 1234", "Ground Coffee")
+	soap := orderCharge("o2", "Visa ending in 5678", "Dish Soap")
+	orders := []models.OrderCharge{coffee, soap}
+	amazon := models.UnapprovedTransaction{Amount: -19990, Payee: "Amazon"}
+
+	byTitle := func(pattern string, category models.CategoryID) models.Rule {
+		return models.Rule{TitlePattern: pattern, CategoryID: category}
+	}
+	tests := []struct {
+		name      string
+		rules     []models.Rule
+		orders    []models.OrderCharge
+		wantRule  models.CategoryID
+		wantOrder string
+	}{
+		{
+			name:      "first rule wins",
+			rules:     []models.Rule{byTitle("coffee", "first"), byTitle("coffee", "second")},
+			orders:    orders,
+			wantRule:  "first",
+			wantOrder: "o1",
+		},
+		{
+			name:      "skips rules that don't match",
+			rules:     []models.Rule{byTitle("tea", "first"), byTitle("soap", "second")},
+			orders:    orders,
+			wantRule:  "second",
+			wantOrder: "o2",
+		},
+		{
+			name:     "rule without order conditions",
+			rules:    []models.Rule{{PayeePattern: "amazon", CategoryID: "payee"}, byTitle("coffee", "title")},
+			orders:   orders,
+			wantRule: "payee",
+		},
+		{
+			name:     "no orders",
+			rules:    []models.Rule{byTitle("coffee", "title"), {PayeePattern: "amazon", CategoryID: "payee"}},
+			wantRule: "payee",
+		},
+		{
+			name:   "nothing matches",
+			rules:  []models.Rule{byTitle("tea", "title")},
+			orders: orders,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var compiled []*Rule
+			for _, r := range tt.rules {
+				compiled = append(compiled, mustCompile(t, r))
+			}
+			rule, order := Suggest(compiled, amazon, tt.orders)
+			var gotRule models.CategoryID
+			if rule != nil {
+				gotRule = rule.CategoryID
+			}
+			var gotOrder string
+			if order != nil {
+				gotOrder = order.ID
+			}
+			if gotRule != tt.wantRule || gotOrder != tt.wantOrder {
+				t.Errorf("Suggest() = %q, %q, want %q, %q", gotRule, gotOrder, tt.wantRule, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func TestPreview(t *testing.T) {
+	approved := orderCharge("o1", "Visa ending in 1234", "Ground Coffee")
+	approved.Matches = []models.Match{
+		{CategoryID: "c-old", Payee: "Target"},
+		{CategoryID: "c-groceries", Payee: "Amazon"},
+	}
+	unapproved := orderCharge("o2", "Visa ending in 1234", "Ground Coffee")
+	soap := orderCharge("o3", "Visa ending in 1234", "Dish Soap")
+	charges := []models.OrderCharge{approved, unapproved, soap}
+
+	t.Run("by title", func(t *testing.T) {
+		hits := Preview(mustCompile(t, models.Rule{TitlePattern: "coffee"}), charges)
+		if len(hits) != 2 {
+			t.Fatalf("%d hits, want 2", len(hits))
+		}
+		if hits[0].ID != "o1" || hits[0].Previous == nil || hits[0].Previous.CategoryID != "c-groceries" {
+			t.Errorf("first hit = %s approved as %+v, want o1 with its latest approval", hits[0].ID, hits[0].Previous)
+		}
+		if hits[1].ID != "o2" || hits[1].Previous != nil {
+			t.Errorf("second hit = %s approved as %+v, want o2 not approved", hits[1].ID, hits[1].Previous)
+		}
+	})
+
+	t.Run("payee from the latest approval", func(t *testing.T) {
+		hits := Preview(mustCompile(t, models.Rule{PayeePattern: "amazon"}), charges)
+		if len(hits) != 1 || hits[0].ID != "o1" {
+			t.Errorf("hits = %+v, want only the approved order", hits)
+		}
+		hits = Preview(mustCompile(t, models.Rule{PayeePattern: "target"}), charges)
+		if len(hits) != 0 {
+			t.Errorf("hits = %+v, want none for an earlier approval's payee", hits)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// CreateToken saves a new API token by the hash of its secret
+func (s *Store) CreateToken(ctx context.Context, name, hash string) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO api_tokens (name, hash, created_at) VALUES (?, ?, ?)",
+		name, hash, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// Tokens lists the API tokens, newest first
+func (s *Store) Tokens(ctx context.Context) ([]models.APIToken, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, created_at, last_used_at
+		FROM api_tokens
+		ORDER BY id DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		var (
+			t          models.APIToken
+			createdAt  string
+			lastUsedAt sql.NullString
+		)
+		if err := rows.Scan(&t.ID, &t.Name, &createdAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+		if t.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		if lastUsedAt.Valid {
+			if t.LastUsedAt, err = time.Parse(time.RFC3339, lastUsedAt.String); err != nil {
+				return nil, err
+			}
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *Store) DeleteToken(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM api_tokens WHERE id = ?", id)
+	return err
+}
+
+// TokenValid reports whether there's an API token with the given hash, and
+// notes that it was used.
+func (s *Store) TokenValid(ctx context.Context, hash string) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE api_tokens SET last_used_at = ? WHERE hash = ?",
+		time.Now().UTC().Format(time.RFC3339), hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CreateSession saves a UI login session by the hash of its ID, and clears
+// out any expired ones.
+func (s *Store) CreateSession(ctx context.Context, hash string, expires time.Time) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at < ?", now); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO sessions (hash, created_at, expires_at) VALUES (?, ?, ?)",
+		hash, now, expires.UTC().Format(time.RFC3339))
+	return err
+}
+
+// SessionValid reports whether there's an unexpired session with the given
+// hash.
+func (s *Store) SessionValid(ctx context.Context, hash string) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM sessions WHERE hash = ? AND expires_at > ?",
+		hash, time.Now().UTC().Format(time.RFC3339)).Scan(&n)
+	return n > 0, err
+}
+
+func (s *Store) DeleteSession(ctx context.Context, hash string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE hash = ?", hash)
+	return err
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// SaveAutoApprovals records transactions that were approved automatically.
+// Their matches are recorded with RecordMatches, like any other approval.
+func (s *Store) SaveAutoApprovals(ctx context.Context, approvals []models.AutoApproval) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, a := range approvals {
+		t := a.Transaction
+		approvedAt := a.ApprovedAt.UTC().Format(time.RFC3339)
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO auto_approvals
+				(budget_id, transaction_id, transaction_amount, transaction_date,
+				transaction_payee, transaction_payee_name, transaction_memo,
+				transaction_category_id, transaction_account,
+				purchase_id, category_id, category_name, payee, reason, score, approved_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, a.BudgetID.String(), t.ID.String(), t.Amount, t.Date.Format(time.DateOnly),
+			t.Payee, t.PayeeName, t.Memo, t.CategoryID.String(), t.Account,
+			a.OrderID, a.CategoryID.String(), a.CategoryName, a.Payee, a.Reason, a.Score, approvedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const autoApprovalColumns = `
+	id, budget_id, transaction_id, transaction_amount, transaction_date,
+	transaction_payee, transaction_payee_name, transaction_memo,
+	transaction_category_id, transaction_account,
+	purchase_id, category_id, category_name, payee, reason, score, approved_at, undone_at
+`
+
+// AutoApprovals lists the automatic approvals, newest first
+func (s *Store) AutoApprovals(ctx context.Context) ([]models.AutoApproval, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+autoApprovalColumns+" FROM auto_approvals ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var approvals []models.AutoApproval
+	for rows.Next() {
+		a, err := scanAutoApproval(rows)
+		if err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, a)
+	}
+	return approvals, rows.Err()
+}
+
+// AutoApproval loads one automatic approval
+func (s *Store) AutoApproval(ctx context.Context, id int64) (models.AutoApproval, error) {
+	return scanAutoApproval(s.db.QueryRowContext(ctx, "SELECT "+autoApprovalColumns+" FROM auto_approvals WHERE id = ?", id))
+}
+
+func scanAutoApproval(row interface{ Scan(...any) error }) (models.AutoApproval, error) {
+	var (
+		a                models.AutoApproval
+		t                = &a.Transaction
+		date, approvedAt string
+		undoneAt         sql.NullString
+	)
+	err := row.Scan(&a.ID, &a.BudgetID, &t.ID, &t.Amount, &date,
+		&t.Payee, &t.PayeeName, &t.Memo, &t.CategoryID, &t.Account,
+		&a.OrderID, &a.CategoryID, &a.CategoryName, &a.Payee, &a.Reason, &a.Score, &approvedAt, &undoneAt)
+	if err != nil {
+		return a, err
+	}
+	if t.Date, err = time.Parse(time.DateOnly, date); err != nil {
+		return a, err
+	}
+	if a.ApprovedAt, err = time.Parse(time.RFC3339, approvedAt); err != nil {
+		return a, err
+	}
+	if undoneAt.Valid {
+		if a.UndoneAt, err = time.Parse(time.RFC3339, undoneAt.String); err != nil {
+			return a, err
+		}
+	}
+	return a, nil
+}
+
+// UndoAutoApproval marks an automatic approval as undone and forgets its
+// match. Putting the transaction back in YNAB is up to the caller.
+func (s *Store) UndoAutoApproval(ctx context.Context, id int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	a, err := scanAutoApproval(tx.QueryRowContext(ctx, "SELECT "+autoApprovalColumns+" FROM auto_approvals WHERE id = ?", id))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE auto_approvals SET undone_at = ? WHERE id = ?",
+		time.Now().UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM matches WHERE purchase_id = ? AND transaction_id = ?",
+		a.OrderID, a.Transaction.ID.String())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+
+	"github.com/ryepup/amazon-exporter/internal/classify"
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// Learn adds approved items to what the classifier knows about a budget
+func (s *Store) Learn(ctx context.Context, budgetID models.BudgetID, examples []classify.Example) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, e := range examples {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO category_examples (budget_id, category_id, category_name, examples)
+			VALUES (?, ?, ?, 1)
+			ON CONFLICT(budget_id, category_id) DO UPDATE SET
+				category_name=excluded.category_name,
+				examples=examples + 1
+		`, budgetID.String(), e.Category.ID.String(), e.Category.Name)
+		if err != nil {
+			return err
+		}
+		for _, token := range classify.Tokens(e.Title) {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO category_tokens (budget_id, category_id, token, count)
+				VALUES (?, ?, ?, 1)
+				ON CONFLICT(budget_id, category_id, token) DO UPDATE SET
+					count=count + 1
+			`, budgetID.String(), e.Category.ID.String(), token)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// Classifier loads what's been learned about a budget's categories
+func (s *Store) Classifier(ctx context.Context, budgetID models.BudgetID) (*classify.Model, error) {
+	m := classify.NewModel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT category_id, category_name, examples
+		FROM category_examples
+		WHERE budget_id = ?
+	`, budgetID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			c models.Category
+			n int
+		)
+		if err := rows.Scan(&c.ID, &c.Name, &n); err != nil {
+			return nil, err
+		}
+		m.AddExamples(c, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT category_id, token, count
+		FROM category_tokens
+		WHERE budget_id = ?
+	`, budgetID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			c     models.CategoryID
+			token string
+			n     int
+		)
+		if err := rows.Scan(&c, &token, &n); err != nil {
+			return nil, err
+		}
+		m.AddToken(c, token, n)
+	}
+	return m, rows.Err()
+}
@@ -9,60 +9,9 @@ func initDatabase(path string) (*sql.DB, error) {
 		return nil, err
 	}
 
-	// Create items table if not exists with a UNIQUE constraint
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS items (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			item TEXT UNIQUE
-		)
-	`)
-	if err != nil {
-		return nil, err
-	}
-
-	// Create purchases table if not exists
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS purchases (
-			id TEXT PRIMARY KEY,
-			href TEXT,
-			price REAL,
-			card TEXT,
-			amount REAL,
-			date TEXT
-		)
-	`)
-	if err != nil {
-		return nil, err
-	}
-
-	// Create purchase_items table if not exists
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS purchase_items (
-			purchase_id TEXT,
-			item_id INTEGER,
-			FOREIGN KEY(purchase_id) REFERENCES purchases(id),
-			FOREIGN KEY(item_id) REFERENCES items(id),
-			PRIMARY KEY (purchase_id, item_id)
-		)
-	`)
-	if err != nil {
-		return nil, err
-	}
-
-	// Create purchase_category table if not exists
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS purchase_category (
-			purchase_id TEXT PRIMARY KEY,
-			category_id TEXT,
-			category_name TEXT,
-			FOREIGN KEY(purchase_id) REFERENCES purchases(id)
-		)`)
-	if err != nil {
-		return nil, err
-	}
-
 	_, err = db.Exec("PRAGMA journal_mode = WAL")
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
@@ -70,6 +19,11 @@ func initDatabase(path string) (*sql.DB, error) {
 	// access
 	db.SetMaxOpenConns(1)
 
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return db, nil
 }
 
@@ -0,0 +1,194 @@
+package store
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer build
+// than this one. We refuse to touch it rather than guess at the schema.
+var ErrSchemaTooNew = errors.New("database schema is newer than this build")
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+
+// migrationFuncs hold Go code that runs after the SQL of the same version, for
+// data changes that SQL can't express well.
+var migrationFuncs = map[int]func(*sql.Tx) error{
+	4: backfillChargeDates,
+}
+
+// migration is one numbered step of the schema, loaded from
+// migrations/NNNN_description.sql
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// loadMigrations reads the NNNN_description.sql files in the root of fsys
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(entries))
+	for _, e := range entries {
+		m := migrationName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("bad migration filename %q", e.Name())
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, err
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{
+			version: version,
+			name:    m[2],
+			sql:     string(body),
+		})
+	}
+
+	slices.SortFunc(migrations, func(a, b migration) int { return a.version - b.version })
+	for i, m := range migrations {
+		// versions must be 1, 2, 3, ... so a typo can't skip a step
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migration %04d_%s out of sequence, expected version %d", m.version, m.name, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// migrate brings the database schema up to the latest embedded migration.
+// Each migration runs in its own transaction along with the schema_version
+// bookkeeping, so a failure leaves the database at the previous version.
+func migrate(db *sql.DB) error {
+	fsys, err := fs.Sub(migrationFS, "migrations")
+	if err != nil {
+		return err
+	}
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return err
+	}
+	return applyMigrations(db, migrations)
+}
+
+// applyMigrations runs the migrations the database hasn't had yet, in order
+func applyMigrations(db *sql.DB, migrations []migration) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	latest := len(migrations)
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d, latest known is %d", ErrSchemaTooNew, current, latest)
+	}
+
+	for _, m := range migrations[current:] {
+		if err := m.apply(db); err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %w", m.version, m.name, err)
+		}
+		log.Printf("applied migration %04d_%s", m.version, m.name)
+	}
+	return nil
+}
+
+func schemaVersion(db *sql.DB) (int, error) {
+	var version sql.NullInt64
+	if err := db.QueryRow("SELECT MAX(version) FROM schema_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+func (m migration) apply(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.sql); err != nil {
+		return err
+	}
+	if fn, ok := migrationFuncs[m.version]; ok {
+		if err := fn(tx); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)",
+		m.version, m.name, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// backfillChargeDates parses the display dates of existing charges into the
+// charged_on column.
+func backfillChargeDates(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, date FROM charges")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	dates := make(map[int64]string)
+	for rows.Next() {
+		var (
+			id   int64
+			date string
+		)
+		if err := rows.Scan(&id, &date); err != nil {
+			return err
+		}
+		t, err := models.Charge{Date: date}.Time()
+		if err != nil {
+			log.Printf("charge %d has unparseable date %q, leaving charged_on empty", id, date)
+			continue
+		}
+		dates[id] = t.Format(time.DateOnly)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, date := range dates {
+		if _, err := tx.Exec("UPDATE charges SET charged_on = ? WHERE id = ?", date, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
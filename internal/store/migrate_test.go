@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+func rawDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrateSchemaTooNew(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.db.Exec("INSERT INTO schema_version (version, name, applied_at) VALUES (999, 'from_the_future', '2030-01-01T00:00:00Z')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if s, err := Open(path); !errors.Is(err, ErrSchemaTooNew) {
+		if err == nil {
+			s.Close()
+		}
+		t.Errorf("Open() error = %v, want %v", err, ErrSchemaTooNew)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		want    []int
+		wantErr bool
+	}{
+		{
+			name: "in order",
+			fsys: fstest.MapFS{
+				"0002_second.sql": file("SELECT 2"),
+				"0001_first.sql":  file("SELECT 1"),
+			},
+			want: []int{1, 2},
+		},
+		{
+			name: "skips a version",
+			fsys: fstest.MapFS{
+				"0001_first.sql": file("SELECT 1"),
+				"0003_third.sql": file("SELECT 3"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "same version twice",
+			fsys: fstest.MapFS{
+				"0001_first.sql": file("SELECT 1"),
+				"0001_again.sql": file("SELECT 1"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "doesn't start at 1",
+			fsys: fstest.MapFS{
+				"0002_second.sql": file("SELECT 2"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "bad filename",
+			fsys: fstest.MapFS{
+				"0001_first.sql": file("SELECT 1"),
+				"second.sql":     file("SELECT 2"),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := loadMigrations(tt.fsys)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("loadMigrations() = %v, want an error", migrations)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, m := range migrations {
+				got = append(got, m.version)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("versions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyMigrationsRollsBack(t *testing.T) {
+	db := rawDB(t, filepath.Join(t.TempDir(), "test.db"))
+	migrations := []migration{
+		{version: 1, name: "first", sql: "CREATE TABLE a (x INTEGER)"},
+		{version: 2, name: "broken", sql: "CREATE TABLE b (x INTEGER); INSERT INTO missing VALUES (1);"},
+	}
+
+	if err := applyMigrations(db, migrations); err == nil {
+		t.Fatal("applyMigrations() succeeded with a broken migration")
+	}
+
+	version, err := schemaVersion(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("schema version = %d, want 1", version)
+	}
+	var tables []string
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name IN ('a', 'b') ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tables, []string{"a"}) {
+		t.Errorf("tables = %v, want the broken migration's table rolled back", tables)
+	}
+
+	// fixing the migration picks up where it left off
+	migrations[1].sql = "CREATE TABLE b (x INTEGER)"
+	if err := applyMigrations(db, migrations); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := schemaVersion(db); err != nil || version != 2 {
+		t.Errorf("schema version = %d, %v, want 2", version, err)
+	}
+}
+
+// TestMigrateBaseline upgrades a database shaped like the ones written before
+// versioned migrations, with its data.
+func TestMigrateBaseline(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := rawDB(t, path)
+	_, err := db.Exec(`
+		CREATE TABLE items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			item TEXT UNIQUE
+		);
+		CREATE TABLE purchases (
+			id TEXT PRIMARY KEY,
+			href TEXT,
+			price REAL,
+			card TEXT,
+			amount REAL,
+			date TEXT
+		);
+		CREATE TABLE purchase_items (
+			purchase_id TEXT,
+			item_id INTEGER,
+			FOREIGN KEY(purchase_id) REFERENCES purchases(id),
+			FOREIGN KEY(item_id) REFERENCES items(id),
+			PRIMARY KEY (purchase_id, item_id)
+		);
+		CREATE TABLE purchase_category (
+			purchase_id TEXT PRIMARY KEY,
+			category_id TEXT,
+			category_name TEXT,
+			FOREIGN KEY(purchase_id) REFERENCES purchases(id)
+		);
+
+		INSERT INTO items (id, item) VALUES (1, 'Coffee'), (2, 'Dish Soap');
+		INSERT INTO purchases (id, href, price, card, amount, date)
+		VALUES ('111-1234567-1234567', 'https://example.com/order', 17.26, 'Visa ****1234', -17.26, 'January 3, 2024');
+		INSERT INTO purchase_items (purchase_id, item_id) VALUES ('111-1234567-1234567', 1), ('111-1234567-1234567', 2);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	fsys, err := fs.Sub(migrationFS, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := schemaVersion(s.db); err != nil || version != len(migrations) {
+		t.Errorf("schema version = %d, %v, want %d", version, err, len(migrations))
+	}
+
+	got, err := s.Load(ctx, "111-1234567-1234567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.Order{
+		ID:    "111-1234567-1234567",
+		Href:  "https://example.com/order",
+		Items: []models.Item{{Title: "Coffee", Quantity: 1}, {Title: "Dish Soap", Quantity: 1}},
+		Price: 17260,
+		Charges: []models.Charge{
+			{Card: "Visa ****1234", Amount: -17260, Date: "January 3, 2024"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,31 @@
+-- The schema as it existed before versioned migrations. Everything is
+-- IF NOT EXISTS so databases created by older builds adopt version 1 as-is.
+
+CREATE TABLE IF NOT EXISTS items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	item TEXT UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS purchases (
+	id TEXT PRIMARY KEY,
+	href TEXT,
+	price REAL,
+	card TEXT,
+	amount REAL,
+	date TEXT
+);
+
+CREATE TABLE IF NOT EXISTS purchase_items (
+	purchase_id TEXT,
+	item_id INTEGER,
+	FOREIGN KEY(purchase_id) REFERENCES purchases(id),
+	FOREIGN KEY(item_id) REFERENCES items(id),
+	PRIMARY KEY (purchase_id, item_id)
+);
+
+CREATE TABLE IF NOT EXISTS purchase_category (
+	purchase_id TEXT PRIMARY KEY,
+	category_id TEXT,
+	category_name TEXT,
+	FOREIGN KEY(purchase_id) REFERENCES purchases(id)
+);
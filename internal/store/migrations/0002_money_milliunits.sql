@@ -0,0 +1,24 @@
+-- Store price and amount as integer milliunits instead of REAL. SQLite can't
+-- change a column type in place, so rebuild the table.
+
+CREATE TABLE purchases_new (
+	id TEXT PRIMARY KEY,
+	href TEXT,
+	price INTEGER,
+	card TEXT,
+	amount INTEGER,
+	date TEXT
+);
+
+INSERT INTO purchases_new (id, href, price, card, amount, date)
+SELECT
+	id,
+	href,
+	CAST(ROUND(price * 1000) AS INTEGER),
+	card,
+	CAST(ROUND(amount * 1000) AS INTEGER),
+	date
+FROM purchases;
+
+DROP TABLE purchases;
+ALTER TABLE purchases_new RENAME TO purchases;
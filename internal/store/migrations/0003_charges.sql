@@ -0,0 +1,25 @@
+-- Orders can be paid by several charges when Amazon splits shipments, so move
+-- the card, amount and date columns out of purchases into their own table.
+-- Two shipments can be billed the same amount to the same card on the same
+-- day, so the charges aren't unique.
+
+CREATE TABLE charges (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_id TEXT NOT NULL,
+	card TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	date TEXT NOT NULL,
+	FOREIGN KEY(purchase_id) REFERENCES purchases(id)
+);
+
+CREATE INDEX charges_purchase_id ON charges (purchase_id);
+CREATE INDEX charges_amount ON charges (amount);
+
+INSERT INTO charges (purchase_id, card, amount, date)
+SELECT id, COALESCE(card, ''), COALESCE(amount, 0), COALESCE(date, '')
+FROM purchases
+WHERE COALESCE(card, '') <> '' OR COALESCE(amount, 0) <> 0;
+
+ALTER TABLE purchases DROP COLUMN card;
+ALTER TABLE purchases DROP COLUMN amount;
+ALTER TABLE purchases DROP COLUMN date;
@@ -0,0 +1,6 @@
+-- Keep a sortable ISO 8601 copy of each charge date next to Amazon's display
+-- string. Existing rows are backfilled in Go, see backfillChargeDates.
+
+ALTER TABLE charges ADD COLUMN charged_on TEXT;
+
+CREATE INDEX charges_charged_on ON charges (charged_on);
@@ -0,0 +1,11 @@
+-- Full-text index over item titles. It's an external content table backed by
+-- items, so Store.Save has to keep it in sync when it adds an item.
+
+CREATE VIRTUAL TABLE items_fts USING fts5(
+	item,
+	content='items',
+	content_rowid='id',
+	tokenize='porter unicode61'
+);
+
+INSERT INTO items_fts(items_fts) VALUES ('rebuild');
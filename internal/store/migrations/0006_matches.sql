@@ -0,0 +1,20 @@
+-- Record which YNAB transaction paid for which order. purchase_category was
+-- keyed by YNAB transaction IDs rather than order IDs, so its rows never
+-- pointed at an order and there's nothing to carry over.
+
+CREATE TABLE matches (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_id TEXT NOT NULL,
+	transaction_id TEXT NOT NULL,
+	budget_id TEXT NOT NULL,
+	category_id TEXT NOT NULL,
+	category_name TEXT NOT NULL,
+	payee TEXT NOT NULL,
+	approved_at TEXT NOT NULL,
+	FOREIGN KEY(purchase_id) REFERENCES purchases(id),
+	UNIQUE (purchase_id, transaction_id)
+);
+
+CREATE INDEX matches_transaction_id ON matches (transaction_id);
+
+DROP TABLE purchase_category;
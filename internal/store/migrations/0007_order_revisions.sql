@@ -0,0 +1,12 @@
+-- Every Store.Save that changes an order records what changed, as a JSON
+-- array of models.FieldChange.
+
+CREATE TABLE order_revisions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_id TEXT NOT NULL,
+	revised_at TEXT NOT NULL,
+	changes TEXT NOT NULL,
+	FOREIGN KEY(purchase_id) REFERENCES purchases(id)
+);
+
+CREATE INDEX order_revisions_purchase_id ON order_revisions (purchase_id, id);
@@ -0,0 +1,16 @@
+-- API tokens for /api and login sessions for the UI. Only SHA-256 hashes of
+-- the secrets are stored.
+
+CREATE TABLE api_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	hash TEXT NOT NULL UNIQUE,
+	created_at TEXT NOT NULL,
+	last_used_at TEXT
+);
+
+CREATE TABLE sessions (
+	hash TEXT PRIMARY KEY,
+	created_at TEXT NOT NULL,
+	expires_at TEXT NOT NULL
+);
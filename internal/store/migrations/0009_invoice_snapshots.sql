@@ -0,0 +1,15 @@
+-- The invoice pages the bookmarklet uploads, gzipped, so they can be parsed
+-- again when the parsers improve. There's no foreign key to purchases, since
+-- pages that couldn't be parsed the first time are kept too.
+
+CREATE TABLE invoice_snapshots (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_id TEXT NOT NULL,
+	href TEXT NOT NULL,
+	-- charges found on the transactions page, as a JSON array of models.Charge
+	charges TEXT NOT NULL,
+	received_at TEXT NOT NULL,
+	sha256 TEXT NOT NULL,
+	html BLOB NOT NULL,
+	UNIQUE(purchase_id, sha256)
+);
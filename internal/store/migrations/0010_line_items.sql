@@ -0,0 +1,53 @@
+-- Items become line items belonging to one order, with the quantity, price
+-- and product details, instead of shared titles in items. The full-text index
+-- now covers purchase_items, kept in sync by triggers.
+
+CREATE TABLE purchase_items_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	asin TEXT NOT NULL DEFAULT '',
+	quantity INTEGER NOT NULL DEFAULT 1,
+	unit_price INTEGER NOT NULL DEFAULT 0,
+	seller TEXT NOT NULL DEFAULT '',
+	url TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY(purchase_id) REFERENCES purchases(id)
+);
+
+INSERT INTO purchase_items_new (purchase_id, position, title)
+SELECT
+	pi.purchase_id,
+	ROW_NUMBER() OVER (PARTITION BY pi.purchase_id ORDER BY i.item) - 1,
+	i.item
+FROM purchase_items pi JOIN items i ON i.id = pi.item_id;
+
+DROP TABLE items_fts;
+DROP TABLE purchase_items;
+DROP TABLE items;
+ALTER TABLE purchase_items_new RENAME TO purchase_items;
+
+CREATE INDEX purchase_items_purchase_id ON purchase_items (purchase_id, position);
+
+CREATE VIRTUAL TABLE items_fts USING fts5(
+	title,
+	asin,
+	content='purchase_items',
+	content_rowid='id',
+	tokenize='porter unicode61'
+);
+
+INSERT INTO items_fts(items_fts) VALUES ('rebuild');
+
+CREATE TRIGGER purchase_items_ai AFTER INSERT ON purchase_items BEGIN
+	INSERT INTO items_fts (rowid, title, asin) VALUES (new.id, new.title, new.asin);
+END;
+
+CREATE TRIGGER purchase_items_ad AFTER DELETE ON purchase_items BEGIN
+	INSERT INTO items_fts (items_fts, rowid, title, asin) VALUES ('delete', old.id, old.title, old.asin);
+END;
+
+CREATE TRIGGER purchase_items_au AFTER UPDATE ON purchase_items BEGIN
+	INSERT INTO items_fts (items_fts, rowid, title, asin) VALUES ('delete', old.id, old.title, old.asin);
+	INSERT INTO items_fts (rowid, title, asin) VALUES (new.id, new.title, new.asin);
+END;
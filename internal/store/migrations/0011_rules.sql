@@ -0,0 +1,18 @@
+-- Rules pick the category and payee for YNAB transactions. Every condition
+-- that's set has to match; empty patterns and zero amounts are unset.
+
+CREATE TABLE rules (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	budget_id TEXT NOT NULL,
+	title_pattern TEXT NOT NULL DEFAULT '',
+	card TEXT NOT NULL DEFAULT '',
+	min_amount INTEGER NOT NULL DEFAULT 0,
+	max_amount INTEGER NOT NULL DEFAULT 0,
+	payee_pattern TEXT NOT NULL DEFAULT '',
+	category_id TEXT NOT NULL,
+	category_name TEXT NOT NULL,
+	payee_name TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL
+);
+
+CREATE INDEX rules_budget_id ON rules (budget_id);
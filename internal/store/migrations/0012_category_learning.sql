@@ -0,0 +1,19 @@
+-- What the category classifier has learned from approvals, per budget:
+-- how many items went into each category, and how often each title word
+-- showed up in them.
+
+CREATE TABLE category_examples (
+	budget_id TEXT NOT NULL,
+	category_id TEXT NOT NULL,
+	category_name TEXT NOT NULL,
+	examples INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (budget_id, category_id)
+);
+
+CREATE TABLE category_tokens (
+	budget_id TEXT NOT NULL,
+	category_id TEXT NOT NULL,
+	token TEXT NOT NULL,
+	count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (budget_id, category_id, token)
+);
@@ -0,0 +1,23 @@
+-- Transactions approved without anyone looking at them. The transaction_*
+-- columns are how the transaction was before, so an approval can be undone.
+
+CREATE TABLE auto_approvals (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	budget_id TEXT NOT NULL,
+	transaction_id TEXT NOT NULL,
+	transaction_amount INTEGER NOT NULL,
+	transaction_date TEXT NOT NULL,
+	transaction_payee TEXT NOT NULL,
+	transaction_payee_name TEXT NOT NULL,
+	transaction_memo TEXT NOT NULL,
+	transaction_category_id TEXT NOT NULL,
+	transaction_account TEXT NOT NULL,
+	purchase_id TEXT NOT NULL,
+	category_id TEXT NOT NULL,
+	category_name TEXT NOT NULL,
+	payee TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	score REAL NOT NULL,
+	approved_at TEXT NOT NULL,
+	undone_at TEXT
+);
@@ -0,0 +1,7 @@
+-- Remember whether each charge was sent with an order or came with an invoice
+-- page, so saving an invoice again can replace the charges the last one
+-- brought instead of piling up whatever an older parser got wrong. Which
+-- charges came from invoices before now isn't known, so they all count as the
+-- order's and are kept.
+
+ALTER TABLE charges ADD COLUMN source TEXT NOT NULL DEFAULT 'order';
@@ -0,0 +1,15 @@
+-- received_at only goes to the second, so when an order's page is uploaded
+-- twice in a second it can't tell which upload was newest. seq goes up with
+-- every save, including the ones that update a page uploaded before.
+
+ALTER TABLE invoice_snapshots ADD COLUMN seq INTEGER NOT NULL DEFAULT 0;
+
+UPDATE invoice_snapshots
+SET seq = (
+	SELECT n
+	FROM (
+		SELECT id, ROW_NUMBER() OVER (ORDER BY received_at, id) AS n
+		FROM invoice_snapshots
+	) AS ordered
+	WHERE ordered.id = invoice_snapshots.id
+);
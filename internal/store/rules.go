@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// SaveRule adds a rule, returning its ID
+func (s *Store) SaveRule(ctx context.Context, r models.Rule) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO rules
+			(budget_id, title_pattern, card, min_amount, max_amount, payee_pattern,
+			category_id, category_name, payee_name, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, r.BudgetID.String(), r.TitlePattern, r.Card, r.MinAmount, r.MaxAmount, r.PayeePattern,
+		r.CategoryID.String(), r.CategoryName, r.PayeeName, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// Rules lists a budget's rules, oldest first, which is the order they're
+// tried in
+func (s *Store) Rules(ctx context.Context, budgetID models.BudgetID) ([]models.Rule, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, budget_id, title_pattern, card, min_amount, max_amount, payee_pattern,
+			category_id, category_name, payee_name, created_at
+		FROM rules
+		WHERE budget_id = ?
+		ORDER BY id
+	`, budgetID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.Rule
+	for rows.Next() {
+		var (
+			r         models.Rule
+			createdAt string
+		)
+		if err := rows.Scan(&r.ID, &r.BudgetID, &r.TitlePattern, &r.Card, &r.MinAmount, &r.MaxAmount,
+			&r.PayeePattern, &r.CategoryID, &r.CategoryName, &r.PayeeName, &createdAt); err != nil {
+			return nil, err
+		}
+		if r.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+func (s *Store) DeleteRule(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM rules WHERE id = ?", id)
+	return err
+}
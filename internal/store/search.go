@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+	"github.com/ryepup/amazon-exporter/internal/query"
+)
+
+// Search finds orders matching every filter in the query. Orders are ranked by
+// how well their items match the query's terms, then newest first.
+func (s *Store) Search(ctx context.Context, q query.Query) ([]models.SearchResult, error) {
+	log.Printf("Search(%+v)", q)
+
+	var (
+		ctes    []string
+		rank    = "0"
+		joins   string
+		where   []string
+		columns = "page.id, NULL, NULL"
+		lines   string
+		args    []any
+	)
+
+	terms := ftsTerms(q.Terms)
+	if len(q.Terms) > 0 && len(terms) == 0 {
+		// only punctuation, there's nothing to look for
+		return []models.SearchResult{}, nil
+	}
+	if len(terms) > 0 {
+		// hits are the items matching any term, for ranking and highlights.
+		// MATERIALIZED keeps bm25 and highlight evaluated in the full-text
+		// query itself, they don't work once SQLite flattens it into the join
+		ctes = append(ctes, `
+			hits AS MATERIALIZED (
+				SELECT
+					rowid AS line_id,
+					bm25(items_fts) AS rank,
+					highlight(items_fts, 0, ?, ?) AS marked
+				FROM items_fts
+				WHERE items_fts MATCH ?
+			)`)
+		args = append(args, models.HighlightStart, models.HighlightEnd, strings.Join(terms, " OR "))
+		joins = `
+			JOIN purchase_items pi ON pi.purchase_id = p.id
+			JOIN hits h ON h.line_id = pi.id`
+		// rank the order by its best hit
+		rank = "MIN(h.rank)"
+		// and then list every hit on the page, for the highlights
+		columns = "page.id, pi.title, h.marked"
+		lines = `
+			JOIN purchase_items pi ON pi.purchase_id = page.id
+			JOIN hits h ON h.line_id = pi.id`
+
+		// and every term has to match one of the order's items, though not
+		// necessarily the same one
+		for _, term := range terms {
+			where = append(where, `p.id IN (
+				SELECT ti.purchase_id
+				FROM items_fts JOIN purchase_items ti ON ti.id = items_fts.rowid
+				WHERE items_fts MATCH ?)`)
+			args = append(args, term)
+		}
+	}
+
+	var charge []string
+	if q.Card != "" {
+		charge = append(charge, "c.card LIKE ?")
+		args = append(args, "%"+q.Card+"%")
+	}
+	if !q.After.IsZero() {
+		charge = append(charge, "c.charged_on >= ?")
+		args = append(args, q.After.Format(time.DateOnly))
+	}
+	if !q.Before.IsZero() {
+		charge = append(charge, "c.charged_on <= ?")
+		args = append(args, q.Before.Format(time.DateOnly))
+	}
+	if len(charge) > 0 {
+		where = append(where, `EXISTS (
+			SELECT 1 FROM charges c
+			WHERE c.purchase_id = p.id AND `+strings.Join(charge, " AND ")+`)`)
+	}
+
+	for _, a := range q.Amounts {
+		where = append(where, fmt.Sprintf(`(
+			ABS(p.price) %[1]s ?
+			OR EXISTS (
+				SELECT 1 FROM charges c
+				WHERE c.purchase_id = p.id AND ABS(c.amount) %[1]s ?))`, a.Op))
+		args = append(args, a.Amount, a.Amount)
+	}
+
+	if q.Category != "" {
+		where = append(where, `EXISTS (
+			SELECT 1 FROM matches m
+			WHERE m.purchase_id = p.id AND m.category_name LIKE ?)`)
+		args = append(args, "%"+q.Category+"%")
+	}
+
+	if len(where) == 0 {
+		where = append(where, "1")
+	}
+
+	// a negative LIMIT is no limit
+	limit := -1
+	if q.Limit > 0 {
+		limit = q.Limit
+	}
+	// page is one row per order, so LIMIT and OFFSET count orders rather
+	// than hits
+	ctes = append(ctes, `
+			page AS (
+				SELECT p.id, `+rank+` AS rank, lc.charged_on
+				FROM
+					purchases p`+joins+`
+					LEFT JOIN (
+						SELECT purchase_id, MAX(charged_on) AS charged_on
+						FROM charges
+						GROUP BY purchase_id
+					) lc ON lc.purchase_id = p.id
+				WHERE `+strings.Join(where, " AND ")+`
+				GROUP BY p.id
+				ORDER BY rank, lc.charged_on DESC, p.id
+				LIMIT ? OFFSET ?
+			)`)
+	args = append(args, limit, q.Offset)
+
+	rows, err := s.db.QueryContext(ctx, `
+		WITH`+strings.Join(ctes, ",")+`
+		SELECT `+columns+`
+		FROM page`+lines+`
+		ORDER BY page.rank, page.charged_on DESC, page.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	highlights := make(map[string]map[string]string)
+	for rows.Next() {
+		var (
+			id           string
+			item, marked sql.NullString
+		)
+		if err := rows.Scan(&id, &item, &marked); err != nil {
+			return nil, err
+		}
+		if _, seen := highlights[id]; !seen {
+			ids = append(ids, id)
+			highlights[id] = make(map[string]string)
+		}
+		if item.Valid {
+			highlights[id][item.String] = marked.String
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	orders, err := loadOrders(ctx, s.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]models.SearchResult, len(orders))
+	for i, o := range orders {
+		results[i] = models.SearchResult{Order: o, Highlights: highlights[o.ID]}
+	}
+	return results, nil
+}
+
+// ftsTerms turns search terms into FTS5 queries, one per term, where each
+// word has to prefix a word in the item title or ASIN and phrases have to
+// appear as written. Quoting keeps punctuation in the search from being read
+// as FTS5 syntax. Terms that are only punctuation are dropped.
+func ftsTerms(terms []string) []string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		words := strings.FieldsFunc(term, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		if len(words) > 0 {
+			parts = append(parts, `"`+strings.Join(words, " ")+`"*`)
+		}
+	}
+	return parts
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+	"github.com/ryepup/amazon-exporter/internal/query"
+)
+
+// searchStore has three orders to search
+func searchStore(t *testing.T) *Store {
+	t.Helper()
+	ctx := context.Background()
+	s := open(t)
+	orders := []models.Order{
+		{
+			ID: "111-0000000-0000001",
+			Items: []models.Item{
+				{Title: "Anker USB-C Cable, 6ft", Quantity: 1, UnitPrice: 12000},
+				{Title: "Bounty Paper Towels, 12 Rolls", Quantity: 1, UnitPrice: 13000},
+			},
+			Price:   25000,
+			Charges: []models.Charge{{Card: "Visa ****1234", Amount: -25000, Date: "March 5, 2024"}},
+		},
+		{
+			ID:      "111-0000000-0000002",
+			Items:   []models.Item{{Title: "Paper Towels, 6 Double Rolls", Quantity: 1, UnitPrice: 9990}},
+			Price:   9990,
+			Charges: []models.Charge{{Card: "Mastercard ****5678", Amount: -9990, Date: "January 10, 2024"}},
+		},
+		{
+			ID:      "111-0000000-0000003",
+			Items:   []models.Item{{Title: "Ground Coffee, Medium Roast", ASIN: "B000000001", Quantity: 1, UnitPrice: 12990}},
+			Price:   12990,
+			Charges: []models.Charge{{Card: "Visa ****1234", Amount: -12990, Date: "February 1, 2024"}},
+		},
+	}
+	for _, o := range orders {
+		if _, err := s.Save(ctx, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.RecordMatches(ctx, []models.Match{{
+		OrderID:       "111-0000000-0000003",
+		TransactionID: "t1",
+		BudgetID:      "b1",
+		CategoryID:    "c1",
+		CategoryName:  "Groceries",
+		Payee:         "Amazon",
+		ApprovedAt:    time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSearch(t *testing.T) {
+	s := searchStore(t)
+	tests := []struct {
+		query string
+		want  []string
+		// ordered is whether want is in the order the results must be
+		ordered bool
+	}{
+		{query: "paper", want: []string{"111-0000000-0000001", "111-0000000-0000002"}},
+		{query: "tow", want: []string{"111-0000000-0000001", "111-0000000-0000002"}},
+		{query: `"paper tow"`, want: []string{"111-0000000-0000001", "111-0000000-0000002"}},
+		{query: `"towels paper"`, want: nil},
+		// terms can match different items of the same order
+		{query: `USB-C "paper tow"`, want: []string{"111-0000000-0000001"}},
+		{query: "cable bounty", want: []string{"111-0000000-0000001"}},
+		{query: "usb coffee", want: nil},
+		{query: "B000000001", want: []string{"111-0000000-0000003"}},
+		{query: "paper card:5678", want: []string{"111-0000000-0000002"}},
+		{query: "paper after:2024-02-01", want: []string{"111-0000000-0000001"}},
+		{query: "amount:>20", want: []string{"111-0000000-0000001"}},
+		{query: "12.99", want: []string{"111-0000000-0000003"}},
+		{query: "category:grocer", want: []string{"111-0000000-0000003"}},
+		{query: "!!!", want: nil},
+		// without terms, newest first
+		{query: "card:1234", want: []string{"111-0000000-0000001", "111-0000000-0000003"}, ordered: true},
+		{query: "", want: []string{"111-0000000-0000001", "111-0000000-0000003", "111-0000000-0000002"}, ordered: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := query.Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, err := s.Search(context.Background(), q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, res := range results {
+				got = append(got, res.ID)
+			}
+			if !tt.ordered {
+				slices.Sort(got)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchHighlights(t *testing.T) {
+	s := searchStore(t)
+	q, err := query.Parse(`USB-C "paper tow"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := s.Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("%d results, want 1", len(results))
+	}
+	mark := func(s string) string { return models.HighlightStart + s + models.HighlightEnd }
+	want := map[string]string{
+		"Anker USB-C Cable, 6ft":        "Anker " + mark("USB-C") + " Cable, 6ft",
+		"Bounty Paper Towels, 12 Rolls": "Bounty " + mark("Paper Towels") + ", 12 Rolls",
+	}
+	if !reflect.DeepEqual(results[0].Highlights, want) {
+		t.Errorf("highlights = %q, want %q", results[0].Highlights, want)
+	}
+}
+
+func TestSearchPaging(t *testing.T) {
+	s := searchStore(t)
+	tests := []struct {
+		query         string
+		limit, offset int
+		want          []string
+	}{
+		{"card:1234", 1, 0, []string{"111-0000000-0000001"}},
+		{"card:1234", 1, 1, []string{"111-0000000-0000003"}},
+		{"card:1234", 1, 2, nil},
+		{"", 2, 1, []string{"111-0000000-0000003", "111-0000000-0000002"}},
+		// pages count orders, not matching items
+		{`USB-C "paper tow"`, 1, 0, []string{"111-0000000-0000001"}},
+		{`USB-C "paper tow"`, 1, 1, nil},
+	}
+	for _, tt := range tests {
+		q, err := query.Parse(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.Limit, q.Offset = tt.limit, tt.offset
+		results, err := s.Search(context.Background(), q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, res := range results {
+			got = append(got, res.ID)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q, limit %d, offset %d) = %v, want %v", tt.query, tt.limit, tt.offset, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// SaveSnapshot keeps a compressed copy of an invoice page. Uploading the same
+// page for the same order again makes it the newest, with the new upload's
+// charges, even within the same second.
+func (s *Store) SaveSnapshot(ctx context.Context, snap models.InvoiceSnapshot) error {
+	sum := sha256.Sum256([]byte(snap.HTML))
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := io.WriteString(zw, snap.HTML); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if snap.Charges == nil {
+		snap.Charges = []models.Charge{}
+	}
+	charges, err := json.Marshal(snap.Charges)
+	if err != nil {
+		return err
+	}
+	if snap.ReceivedAt.IsZero() {
+		snap.ReceivedAt = time.Now()
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO invoice_snapshots
+			(purchase_id, href, charges, received_at, sha256, html, seq)
+		VALUES (?, ?, ?, ?, ?, ?, (SELECT COALESCE(MAX(seq), 0) + 1 FROM invoice_snapshots))
+		ON CONFLICT(purchase_id, sha256) DO UPDATE SET
+			href=excluded.href,
+			charges=excluded.charges,
+			received_at=excluded.received_at,
+			seq=excluded.seq
+	`, snap.OrderID, snap.Href, string(charges), snap.ReceivedAt.UTC().Format(time.RFC3339),
+		hex.EncodeToString(sum[:]), compressed.Bytes())
+	return err
+}
+
+// LatestSnapshots lists the ID of the newest snapshot of each order, to load
+// one at a time with Snapshot.
+func (s *Store) LatestSnapshots(ctx context.Context) ([]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id
+		FROM (
+			SELECT
+				id,
+				purchase_id,
+				ROW_NUMBER() OVER (
+					PARTITION BY purchase_id
+					ORDER BY seq DESC
+				) AS n
+			FROM invoice_snapshots
+		)
+		WHERE n = 1
+		ORDER BY purchase_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Snapshot loads one invoice snapshot, returning sql.ErrNoRows if it's missing
+func (s *Store) Snapshot(ctx context.Context, id int64) (models.InvoiceSnapshot, error) {
+	var (
+		snap                models.InvoiceSnapshot
+		charges, receivedAt string
+		compressed          []byte
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, purchase_id, href, charges, received_at, html
+		FROM invoice_snapshots
+		WHERE id = ?
+	`, id).Scan(&snap.ID, &snap.OrderID, &snap.Href, &charges, &receivedAt, &compressed)
+	if err != nil {
+		return snap, err
+	}
+
+	if err := json.Unmarshal([]byte(charges), &snap.Charges); err != nil {
+		return snap, err
+	}
+	if snap.ReceivedAt, err = time.Parse(time.RFC3339, receivedAt); err != nil {
+		return snap, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return snap, err
+	}
+	html, err := io.ReadAll(zr)
+	if err != nil {
+		return snap, err
+	}
+	snap.HTML = string(html)
+	return snap, nil
+}
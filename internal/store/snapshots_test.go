@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+func TestLatestSnapshots(t *testing.T) {
+	ctx := context.Background()
+	s := open(t)
+	// all in the same second, so only the order they're saved in counts
+	receivedAt := time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)
+	save := func(id, html string) {
+		t.Helper()
+		snap := models.InvoiceSnapshot{OrderID: id, Href: "https://example.com/" + id, HTML: html, ReceivedAt: receivedAt}
+		if err := s.SaveSnapshot(ctx, snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+	latest := func() map[string]string {
+		t.Helper()
+		ids, err := s.LatestSnapshots(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages := map[string]string{}
+		for _, id := range ids {
+			snap, err := s.Snapshot(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages[snap.OrderID] = snap.HTML
+		}
+		return pages
+	}
+
+	save("111-0000000-0000001", "<p>first</p>")
+	save("111-0000000-0000001", "<p>second</p>")
+	save("111-0000000-0000002", "<p>other</p>")
+	if got := latest(); got["111-0000000-0000001"] != "<p>second</p>" || got["111-0000000-0000002"] != "<p>other</p>" || len(got) != 2 {
+		t.Errorf("latest = %v, want the second page and the other order's", got)
+	}
+
+	// the first page again is the newest, though it was saved before
+	save("111-0000000-0000001", "<p>first</p>")
+	if got := latest()["111-0000000-0000001"]; got != "<p>first</p>" {
+		t.Errorf("latest = %q after uploading the first page again", got)
+	}
+}
@@ -3,12 +3,11 @@ package store
 import (
 	"context"
 	"database/sql"
-	"errors"
+	"encoding/json"
 	"fmt"
-	"log"
-	"math"
 	"slices"
-	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ryepup/amazon-exporter/internal/models"
 )
@@ -18,272 +17,532 @@ type Store struct {
 	db *sql.DB
 }
 
+// querier is a *sql.DB or *sql.Tx. There's only one connection, so anything
+// that reads during a transaction has to go through the transaction.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
 func (s *Store) Close() error { return s.db.Close() }
 
-func (s *Store) Save(request models.Order) (created bool, err error) {
+// chargeSource is what kind of save stored a charge
+type chargeSource string
+
+const (
+	// fromOrder charges were sent with the order, and accumulate
+	fromOrder chargeSource = "order"
+	// fromInvoice charges came with an invoice page, and are replaced each time
+	// the order's invoice is saved, like by a reparse
+	fromInvoice chargeSource = "invoice"
+)
+
+// Save inserts or updates an order, recording a revision with whatever
+// changed. Items are replaced by the request's items, but charges accumulate:
+// the bookmarklet sees each shipment's charge as a separate transaction row,
+// so we keep the ones we already know about.
+func (s *Store) Save(ctx context.Context, request models.Order) (created bool, err error) {
+	return s.saveOne(ctx, request, fromOrder)
+}
+
+// SaveInvoice is Save for an order read from its invoice page. The invoice's
+// charges replace the ones the order's last invoice brought rather than
+// accumulating, so reparsing with a fixed parser corrects or drops them.
+// Charges sent with the order itself are kept.
+func (s *Store) SaveInvoice(ctx context.Context, request models.Order) (created bool, err error) {
+	return s.saveOne(ctx, request, fromInvoice)
+}
 
-	tx, err := s.db.Begin()
+func (s *Store) saveOne(ctx context.Context, request models.Order, source chargeSource) (created bool, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return false, err
 	}
 	defer tx.Rollback()
 
-	// uniqify the items
-	slices.Sort(request.Items)
-	request.Items = slices.Compact(request.Items)
+	created, err = s.save(ctx, tx, request, source)
+	if err != nil {
+		return false, err
+	}
+	return created, tx.Commit()
+}
+
+// batchSize is how many orders SaveBatch commits in one transaction
+const batchSize = 500
 
-	// Save items to the database and get their IDs
-	itemIDs := make([]int64, 0, len(request.Items))
-	for _, item := range request.Items {
-		itemID, err := s.saveItem(item, tx)
+// SaveBatch saves many orders, committing them in chunks. Each order succeeds
+// or fails on its own, so one bad order doesn't stop the rest; the returned
+// error is only for problems with the database itself.
+func (s *Store) SaveBatch(ctx context.Context, orders []models.Order) ([]models.SaveResult, error) {
+	results := make([]models.SaveResult, 0, len(orders))
+	for chunk := range slices.Chunk(orders, batchSize) {
+		chunkResults, err := s.saveChunk(ctx, chunk)
 		if err != nil {
-			return false, err
+			return results, err
+		}
+		results = append(results, chunkResults...)
+	}
+	return results, nil
+}
+
+func (s *Store) saveChunk(ctx context.Context, orders []models.Order) ([]models.SaveResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]models.SaveResult, 0, len(orders))
+	for _, o := range orders {
+		// a savepoint per order, so a failure only undoes that order
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT save_order"); err != nil {
+			return nil, err
+		}
+		res := models.SaveResult{ID: o.ID}
+		res.Created, res.Err = s.save(ctx, tx, o, fromOrder)
+		if res.Err != nil {
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO save_order"); err != nil {
+				return nil, err
+			}
 		}
-		itemIDs = append(itemIDs, itemID)
+		if _, err := tx.ExecContext(ctx, "RELEASE save_order"); err != nil {
+			return nil, err
+		}
+		results = append(results, res)
 	}
+	return results, tx.Commit()
+}
 
-	exists, err := s.hasOrder(request.ID, tx)
+// save does the work of Save and SaveInvoice inside the caller's transaction
+func (s *Store) save(ctx context.Context, tx *sql.Tx, request models.Order, source chargeSource) (created bool, err error) {
+	existing, err := loadOrders(ctx, tx, []string{request.ID})
 	if err != nil {
 		return false, err
 	}
-	// delete any previous records
+	var previous models.Order
+	exists := len(existing) > 0
 	if exists {
-		_, err = tx.Exec("DELETE FROM purchase_items WHERE purchase_id = ?", request.ID)
-		if err != nil {
-			return false, fmt.Errorf("existing purchase_items not deleted: %w", err)
+		previous = existing[0]
+	}
+	stored, err := loadCharges(ctx, tx, request.ID)
+	if err != nil {
+		return false, err
+	}
+	added, removed, claimed := chargeChanges(stored, request.Charges, source)
+	// the charges we have stay as they are, even if the request writes the
+	// card differently
+	request.Charges = nil
+	for _, sc := range stored {
+		if !slices.Contains(removed, sc.id) {
+			request.Charges = append(request.Charges, sc.charge)
 		}
-		_, err = tx.Exec("DELETE FROM purchases WHERE id = ?", request.ID)
-		if err != nil {
-			return false, fmt.Errorf("existing purchase not deleted: %w", err)
+	}
+	request.Charges = append(request.Charges, added...)
+
+	// the order sent charges an invoice brought, so they're the order's now and
+	// stay even if the invoice stops showing them
+	for _, id := range claimed {
+		if _, err := tx.ExecContext(ctx, "UPDATE charges SET source = ? WHERE id = ?", fromOrder, id); err != nil {
+			return false, fmt.Errorf("charge not updated: %w", err)
 		}
 	}
 
+	changes := models.Diff(previous, request)
+	if exists && len(changes) == 0 {
+		return false, nil
+	}
+
 	// Save purchase information to the database
-	_, err = tx.Exec(`
-			INSERT INTO purchases (id, href, price, card, amount, date)
-			VALUES (?, ?, ?, ?, ?, ?)
-		`, request.ID, request.Href, request.Price, request.Charge.Card, request.Charge.Amount, request.Charge.Date)
+	_, err = tx.ExecContext(ctx, `
+			INSERT INTO purchases (id, href, price)
+			VALUES (?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET
+				href=excluded.href,
+				price=excluded.price
+		`, request.ID, request.Href, request.Price)
 	if err != nil {
 		return false, fmt.Errorf("purchase not inserted: %w", err)
 	}
 
-	// Relate items to the purchase in the purchase_items table
-	for _, itemID := range itemIDs {
-		_, err := tx.Exec("INSERT INTO purchase_items (purchase_id, item_id) VALUES (?, ?)", request.ID, itemID)
+	// items are replaced as a whole, triggers keep items_fts in sync
+	if !slices.Equal(previous.Items, request.Items) {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM purchase_items WHERE purchase_id = ?", request.ID); err != nil {
+			return false, fmt.Errorf("purchase items not deleted: %w", err)
+		}
+		for pos, item := range request.Items {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO purchase_items
+					(purchase_id, position, title, asin, quantity, unit_price, seller, url)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			`, request.ID, pos, item.Title, item.ASIN, item.Quantity, item.UnitPrice, item.Seller, item.URL)
+			if err != nil {
+				return false, fmt.Errorf("purchase item not inserted: %w", err)
+			}
+		}
+	}
+
+	for _, id := range removed {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM charges WHERE id = ?", id); err != nil {
+			return false, fmt.Errorf("charge not deleted: %w", err)
+		}
+	}
+	for _, c := range added {
+		var chargedOn sql.NullString
+		if t, err := c.Time(); err == nil {
+			chargedOn = sql.NullString{String: t.Format(time.DateOnly), Valid: true}
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO charges (purchase_id, card, amount, date, charged_on, source)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, request.ID, c.Card, c.Amount, c.Date, chargedOn, source)
 		if err != nil {
-			return false, fmt.Errorf("purchase item not inserted: %w", err)
+			return false, fmt.Errorf("charge not inserted: %w", err)
 		}
 	}
 
-	return !exists, tx.Commit()
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO order_revisions (purchase_id, revised_at, changes)
+		VALUES (?, ?, ?)
+	`, request.ID, time.Now().UTC().Format(time.RFC3339), string(changesJSON))
+	if err != nil {
+		return false, fmt.Errorf("revision not inserted: %w", err)
+	}
+
+	return !exists, nil
 }
 
-func (s *Store) saveItem(item string, tx *sql.Tx) (int64, error) {
-	var existingID int64
-	err := tx.QueryRow("SELECT id FROM items WHERE item = ?", item).Scan(&existingID)
-	switch {
-	case err == nil:
-		return existingID, nil
-	case errors.Is(err, sql.ErrNoRows):
-		result, err := tx.Exec("INSERT INTO items (item) VALUES (?)", item)
-		if err != nil {
-			return 0, fmt.Errorf("item not inserted: %w", err)
+// storedCharge is a row of the charges table
+type storedCharge struct {
+	id     int64
+	charge models.Charge
+	source chargeSource
+}
+
+// loadCharges gets an order's charges with where they came from
+func loadCharges(ctx context.Context, tx *sql.Tx, id string) ([]storedCharge, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, card, amount, date, source
+		FROM charges
+		WHERE purchase_id = ?
+		ORDER BY charged_on, id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stored []storedCharge
+	for rows.Next() {
+		var sc storedCharge
+		if err := rows.Scan(&sc.id, &sc.charge.Card, &sc.charge.Amount, &sc.charge.Date, &sc.source); err != nil {
+			return nil, err
 		}
-		itemID, _ := result.LastInsertId()
-		return itemID, nil
-	default:
-		return 0, err
+		stored = append(stored, sc)
 	}
+	return stored, rows.Err()
 }
 
-func (s *Store) hasOrder(ID string, tx *sql.Tx) (bool, error) {
-	var existingID string
-	err := tx.QueryRow("SELECT id FROM purchases WHERE id = ?", ID).Scan(&existingID)
-	switch {
-	case err == nil:
-		return true, nil
-	case errors.Is(err, sql.ErrNoRows):
-		return false, nil
-	default:
-		return false, err
+// chargeChanges works out what saving charges from source does to the stored
+// ones: the charges to add, the IDs of the ones to remove, and the IDs of the
+// ones an invoice brought that the order has claimed. Charges sent with the
+// order accumulate. An invoice's charges, less the ones the order already
+// has, replace the ones an invoice brought before.
+func chargeChanges(stored []storedCharge, charges []models.Charge, source chargeSource) (added []models.Charge, removed, claimed []int64) {
+	var fromOrders, fromInvoices []storedCharge
+	for _, sc := range stored {
+		if sc.source == fromOrder {
+			fromOrders = append(fromOrders, sc)
+		} else {
+			fromInvoices = append(fromInvoices, sc)
+		}
+	}
+	// takes the first stored charge that's the same as c
+	take := func(have *[]storedCharge, c models.Charge) (storedCharge, bool) {
+		i := slices.IndexFunc(*have, func(sc storedCharge) bool { return sc.charge.Same(c) })
+		if i < 0 {
+			return storedCharge{}, false
+		}
+		sc := (*have)[i]
+		*have = slices.Delete(*have, i, i+1)
+		return sc, true
+	}
+
+	if source == fromInvoice {
+		for _, c := range charges {
+			if _, ok := take(&fromOrders, c); ok {
+				continue
+			}
+			if _, ok := take(&fromInvoices, c); !ok {
+				added = append(added, c)
+			}
+		}
+		for _, sc := range fromInvoices {
+			removed = append(removed, sc.id)
+		}
+		return added, removed, nil
 	}
-}
 
-func (s *Store) Search(ctx context.Context, query string) ([]models.Order, error) {
-	log.Printf("Search(%v)", query)
-	if n, err := strconv.ParseFloat(query, 32); err == nil {
-		return s.loadByPriceOrAmount(ctx, n)
-	} else if n, err := strconv.ParseInt(query, 10, 32); err == nil {
-		return s.loadByPriceOrAmount(ctx, float64(n))
+	for _, c := range charges {
+		if _, ok := take(&fromOrders, c); ok {
+			continue
+		}
+		if sc, ok := take(&fromInvoices, c); ok {
+			claimed = append(claimed, sc.id)
+		} else {
+			added = append(added, c)
+		}
 	}
-	return s.loadBySearch(ctx, query)
+	return added, nil, claimed
 }
 
-func (s *Store) Load(id string) (models.Order, error) {
-	// Query to fetch purchase details and associated items
-	query := `
-        SELECT
-            p.id,
-            p.href,
-            p.price,
-            p.card,
-            p.amount,
-            p.date,
-            i.item
-        FROM
-            purchases p
-            LEFT JOIN purchase_items pi ON p.id = pi.purchase_id
-            LEFT JOIN items i ON pi.item_id = i.id
-        WHERE
-            p.id = ?;
-    `
-
-	// Execute the query
-	rows, err := s.db.Query(query, id)
+// FindCharges retrieves the charges on or between the given dates, along with
+// their orders.
+func (s *Store) FindCharges(ctx context.Context, from, to time.Time) ([]models.OrderCharge, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			purchase_id, card, amount, date
+		FROM
+			charges
+		WHERE
+			charged_on BETWEEN ? AND ?
+		ORDER BY charged_on DESC
+	`, from.Format(time.DateOnly), to.Format(time.DateOnly))
 	if err != nil {
-		return models.Order{}, err
+		return nil, err
 	}
 	defer rows.Close()
-	o, err := s.rowsToOrders(rows)
+
+	var (
+		ids     []string
+		charges []models.Charge
+	)
+	for rows.Next() {
+		var (
+			id string
+			c  models.Charge
+		)
+		if err := rows.Scan(&id, &c.Card, &c.Amount, &c.Date); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+		charges = append(charges, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	orders, err := loadOrders(ctx, s.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Order, len(orders))
+	for _, o := range orders {
+		byID[o.ID] = o
+	}
+
+	ret := make([]models.OrderCharge, 0, len(charges))
+	for i, c := range charges {
+		ret = append(ret, models.OrderCharge{Order: byID[ids[i]], Charge: c})
+	}
+	return ret, nil
+}
+
+func (s *Store) Load(ctx context.Context, id string) (models.Order, error) {
+	o, err := loadOrders(ctx, s.db, []string{id})
 	if err != nil {
 		return models.Order{}, err
 	}
+	if len(o) == 0 {
+		return models.Order{}, sql.ErrNoRows
+	}
 	return o[0], nil
 }
 
-// loadByPriceOrAmount retrieves orders from the database where either the price or the amount matches the given value.
-func (s *Store) loadByPriceOrAmount(ctx context.Context, value float64) ([]models.Order, error) {
-	value = math.Abs(value)
-	log.Printf("loadByPriceOrAmount(%v)", value)
-	// Query to fetch orders based on price or amount
-	query := `
-        SELECT
-            p.id,
-            p.href,
-            p.price,
-            p.card,
-            p.amount,
-            p.date,
-            i.item
-        FROM
-            purchases p
-            LEFT JOIN purchase_items pi ON p.id = pi.purchase_id
-            LEFT JOIN items i ON pi.item_id = i.id
-        WHERE
-			ABS(p.price) BETWEEN (?-0.001) AND (?+0.001)
-			OR ABS(p.amount) BETWEEN (?-0.001) AND (?+0.001)
-    `
-
-	// Execute the query
-	rows, err := s.db.QueryContext(ctx, query, value, value, value, value)
+// loadOrders fetches the orders with the given IDs along with their items,
+// charges and matches, in the same order as ids. Unknown IDs are skipped.
+func loadOrders(ctx context.Context, db querier, ids []string) ([]models.Order, error) {
+	if len(ids) == 0 {
+		return []models.Order{}, nil
+	}
+	in := "(" + strings.Repeat("?,", len(ids)-1) + "?)"
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	orderData := make(map[string]*models.Order, len(ids))
+
+	rows, err := db.QueryContext(ctx, "SELECT id, href, price FROM purchases WHERE id IN "+in, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	for rows.Next() {
+		o := &models.Order{Items: []models.Item{}, Charges: []models.Charge{}}
+		if err := rows.Scan(&o.ID, &o.Href, &o.Price); err != nil {
+			return nil, err
+		}
+		orderData[o.ID] = o
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return s.rowsToOrders(rows)
-}
-
-// loadBySearch retrieves orders from the database where the card, item, or date contains the given string.
-func (s *Store) loadBySearch(ctx context.Context, search string) ([]models.Order, error) {
-	log.Printf("loadBySearch(%v)", search)
-
-	// Query to fetch orders based on card, item, or date containing the search string
-	query := `
-        SELECT
-            p.id,
-            p.href,
-            p.price,
-            p.card,
-            p.amount,
-            p.date,
-            i.item
-        FROM
-            purchases p
-            LEFT JOIN purchase_items pi ON p.id = pi.purchase_id
-            LEFT JOIN items i ON pi.item_id = i.id
-        WHERE
-            p.card LIKE ? OR i.item LIKE ? OR p.date LIKE ?;
-    `
-
-	// Execute the query
-	rows, err := s.db.QueryContext(ctx, query, "%"+search+"%", "%"+search+"%", "%"+search+"%")
+	rows, err = db.QueryContext(ctx, `
+		SELECT purchase_id, title, asin, quantity, unit_price, seller, url
+		FROM purchase_items
+		WHERE purchase_id IN `+in+`
+		ORDER BY position`, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	for rows.Next() {
+		var (
+			id   string
+			item models.Item
+		)
+		if err := rows.Scan(&id, &item.Title, &item.ASIN, &item.Quantity, &item.UnitPrice, &item.Seller, &item.URL); err != nil {
+			return nil, err
+		}
+		if o, ok := orderData[id]; ok {
+			o.Items = append(o.Items, item)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return s.rowsToOrders(rows)
-}
-
-func (s *Store) rowsToOrders(rows *sql.Rows) ([]models.Order, error) {
-	// Map to store order details and associated items
-	orderData := make(map[string]*models.Order)
-
-	// Iterate over the rows and collect data
+	rows, err = db.QueryContext(ctx, `
+		SELECT purchase_id, card, amount, date
+		FROM charges
+		WHERE purchase_id IN `+in+`
+		ORDER BY charged_on, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 	for rows.Next() {
 		var (
-			orderID string
-			href    string
-			price   float64
-			card    string
-			amount  float64
-			date    string
-			item    sql.NullString
+			id string
+			c  models.Charge
 		)
+		if err := rows.Scan(&id, &c.Card, &c.Amount, &c.Date); err != nil {
+			return nil, err
+		}
+		if o, ok := orderData[id]; ok {
+			o.Charges = append(o.Charges, c)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		if err := rows.Scan(&orderID, &href, &price, &card, &amount, &date, &item); err != nil {
+	rows, err = db.QueryContext(ctx, `
+		SELECT purchase_id, transaction_id, budget_id, category_id, category_name, payee, approved_at
+		FROM matches
+		WHERE purchase_id IN `+in+`
+		ORDER BY approved_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			m          models.Match
+			approvedAt string
+		)
+		err := rows.Scan(&m.OrderID, &m.TransactionID, &m.BudgetID, &m.CategoryID, &m.CategoryName, &m.Payee, &approvedAt)
+		if err != nil {
+			return nil, err
+		}
+		if m.ApprovedAt, err = time.Parse(time.RFC3339, approvedAt); err != nil {
 			return nil, err
 		}
+		if o, ok := orderData[m.OrderID]; ok {
+			o.Matches = append(o.Matches, m)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		// Check if the order already exists in the map
-		if existingOrder, ok := orderData[orderID]; ok {
-			// Add the item to the existing order's items
-			if item.Valid {
-				existingOrder.Items = append(existingOrder.Items, item.String)
-			}
-		} else {
-			// Create a new order and add it to the map
-			newOrder := models.Order{
-				ID:    orderID,
-				Href:  href,
-				Items: []string{},
-				Price: price,
-				Charge: models.Charge{
-					Card:   card,
-					Amount: amount,
-					Date:   date,
-				},
-			}
+	ret := make([]models.Order, 0, len(orderData))
+	for _, id := range ids {
+		if o, ok := orderData[id]; ok {
+			ret = append(ret, *o)
+			// guard against the same ID twice
+			delete(orderData, id)
+		}
+	}
+	return ret, nil
+}
 
-			// Add the item to the new order's items
-			if item.Valid {
-				newOrder.Items = append(newOrder.Items, item.String)
-			}
+// Delete removes an order along with its charges, matches and history. It
+// returns sql.ErrNoRows if there's no such order.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-			orderData[orderID] = &newOrder
+	for _, table := range []string{"purchase_items", "charges", "matches", "order_revisions", "invoice_snapshots"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE purchase_id = ?", id); err != nil {
+			return fmt.Errorf("%s not deleted: %w", table, err)
 		}
 	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM purchases WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("purchase not deleted: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
 
-	// Check for errors from iterating over rows
-	if err := rows.Err(); err != nil {
+// Revisions lists the changes made to an order, oldest first.
+func (s *Store) Revisions(ctx context.Context, id string) ([]models.Revision, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, purchase_id, revised_at, changes
+		FROM order_revisions
+		WHERE purchase_id = ?
+		ORDER BY id
+	`, id)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	orders := make([]models.Order, 0, len(orderData))
-	for _, order := range orderData {
-		orders = append(orders, *order)
+	revisions := []models.Revision{}
+	for rows.Next() {
+		var (
+			r                  models.Revision
+			revisedAt, changes string
+		)
+		if err := rows.Scan(&r.ID, &r.OrderID, &revisedAt, &changes); err != nil {
+			return nil, err
+		}
+		if r.RevisedAt, err = time.Parse(time.RFC3339, revisedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &r.Changes); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
 	}
-
-	slices.SortFunc(orders, func(a, b models.Order) int {
-		// sort DESC
-		return b.Charge.CmpTime(a.Charge)
-	})
-	return orders, nil
+	return revisions, rows.Err()
 }
 
-// SetPurchaseCategory sets the categories for multiple purchases in bulk.
-func (s *Store) RecordCategories(ctx context.Context, updates map[models.TransactionID]models.TransactionUpdate) error {
+// RecordMatches saves which orders YNAB transactions were approved against.
+// Recording the same order and transaction again updates the category and
+// payee.
+func (s *Store) RecordMatches(ctx context.Context, matches []models.Match) error {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -291,20 +550,25 @@ func (s *Store) RecordCategories(ctx context.Context, updates map[models.Transac
 	defer tx.Rollback()
 
 	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO purchase_category
-			(purchase_id, category_id, category_name)
-		VALUES (?, ?, ?)
-		ON CONFLICT(purchase_id) DO UPDATE SET
+		INSERT INTO matches
+			(purchase_id, transaction_id, budget_id, category_id, category_name, payee, approved_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(purchase_id, transaction_id) DO UPDATE SET
+			budget_id=excluded.budget_id,
 			category_id=excluded.category_id,
-			category_name=excluded.category_name
+			category_name=excluded.category_name,
+			payee=excluded.payee,
+			approved_at=excluded.approved_at
 		`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	for tid, update := range updates {
-		if _, err := stmt.ExecContext(ctx, string(tid), update.CategoryID.String(), update.CategoryName); err != nil {
+	for _, m := range matches {
+		_, err := stmt.ExecContext(ctx, m.OrderID, m.TransactionID.String(), m.BudgetID.String(),
+			m.CategoryID.String(), m.CategoryName, m.Payee, m.ApprovedAt.UTC().Format(time.RFC3339))
+		if err != nil {
 			return err
 		}
 	}
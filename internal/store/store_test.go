@@ -0,0 +1,234 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+	_ "modernc.org/sqlite"
+)
+
+func open(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSaveCharges(t *testing.T) {
+	scraped := models.Charge{Card: "Visa ****1234", Amount: -17260, Date: "January 3, 2024"}
+	invoiced := models.Charge{Card: "Visa ending in 1234", Amount: -17260, Date: "January 3, 2024"}
+	other := models.Charge{Card: "Visa ****1234", Amount: -5000, Date: "January 5, 2024"}
+
+	tests := []struct {
+		name  string
+		saves [][]models.Charge
+		want  []models.Charge
+		// revisions is how many saves changed anything
+		revisions int
+	}{
+		{
+			name:      "card written differently",
+			saves:     [][]models.Charge{{scraped}, {invoiced}},
+			want:      []models.Charge{scraped},
+			revisions: 1,
+		},
+		{
+			name:      "two shipments the same day",
+			saves:     [][]models.Charge{{scraped, scraped}, {invoiced, invoiced}},
+			want:      []models.Charge{scraped, scraped},
+			revisions: 1,
+		},
+		{
+			name:      "a shipment the first save missed",
+			saves:     [][]models.Charge{{scraped}, {invoiced, invoiced}},
+			want:      []models.Charge{scraped, invoiced},
+			revisions: 2,
+		},
+		{
+			name:      "charges accumulate",
+			saves:     [][]models.Charge{{scraped}, {other}},
+			want:      []models.Charge{scraped, other},
+			revisions: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open(t)
+			order := models.Order{
+				ID:    "111-1234567-1234567",
+				Items: []models.Item{{Title: "Coffee", Quantity: 1, UnitPrice: 17260}},
+				Price: 17260,
+			}
+			for _, charges := range tt.saves {
+				order.Charges = charges
+				if _, err := s.Save(ctx, order); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := s.Load(ctx, order.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Charges, tt.want) {
+				t.Errorf("charges = %v, want %v", got.Charges, tt.want)
+			}
+			revisions, err := s.Revisions(ctx, order.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(revisions) != tt.revisions {
+				t.Errorf("%d revisions, want %d", len(revisions), tt.revisions)
+			}
+		})
+	}
+}
+
+func TestSaveInvoiceCharges(t *testing.T) {
+	scraped := models.Charge{Card: "Visa ****1234", Amount: -17260, Date: "January 3, 2024"}
+	invoiced := models.Charge{Card: "Visa ending in 1234", Amount: -17260, Date: "January 3, 2024"}
+	wrong := models.Charge{Card: "Visa ending in 1234", Amount: -1726, Date: "January 3, 2024"}
+	other := models.Charge{Card: "Visa ending in 1234", Amount: -5000, Date: "January 5, 2024"}
+
+	// save is one save of the order's charges, with SaveInvoice or Save
+	type save struct {
+		invoice bool
+		charges []models.Charge
+	}
+	tests := []struct {
+		name  string
+		saves []save
+		want  []models.Charge
+	}{
+		{
+			name:  "a reparse fixes a charge",
+			saves: []save{{true, []models.Charge{wrong}}, {true, []models.Charge{invoiced}}},
+			want:  []models.Charge{invoiced},
+		},
+		{
+			name:  "a reparse drops a charge",
+			saves: []save{{true, []models.Charge{invoiced, other}}, {true, []models.Charge{invoiced}}},
+			want:  []models.Charge{invoiced},
+		},
+		{
+			name:  "the same charges again",
+			saves: []save{{true, []models.Charge{invoiced, invoiced}}, {true, []models.Charge{invoiced, invoiced}}},
+			want:  []models.Charge{invoiced, invoiced},
+		},
+		{
+			name:  "the order's charges stay",
+			saves: []save{{false, []models.Charge{scraped}}, {true, []models.Charge{invoiced, wrong}}, {true, nil}},
+			want:  []models.Charge{scraped},
+		},
+		{
+			name:  "the order claims an invoice's charge",
+			saves: []save{{true, []models.Charge{invoiced}}, {false, []models.Charge{scraped}}, {true, nil}},
+			want:  []models.Charge{invoiced},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open(t)
+			order := models.Order{
+				ID:    "111-1234567-1234567",
+				Items: []models.Item{{Title: "Coffee", Quantity: 1, UnitPrice: 17260}},
+				Price: 17260,
+			}
+			for _, sv := range tt.saves {
+				order.Charges = sv.charges
+				save := s.Save
+				if sv.invoice {
+					save = s.SaveInvoice
+				}
+				if _, err := save(ctx, order); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := s.Load(ctx, order.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Charges, tt.want) {
+				t.Errorf("charges = %v, want %v", got.Charges, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveBatch(t *testing.T) {
+	ctx := context.Background()
+	s := open(t)
+	// make one order fail partway through saving, after its purchase and
+	// items are written
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TRIGGER fail_charge BEFORE INSERT ON charges
+		WHEN NEW.card = 'broken'
+		BEGIN SELECT RAISE(ABORT, 'broken card'); END
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := func(id, card string) models.Order {
+		return models.Order{
+			ID:      id,
+			Items:   []models.Item{{Title: "Coffee " + id, Quantity: 1, UnitPrice: 17260}},
+			Price:   17260,
+			Charges: []models.Charge{{Card: card, Amount: -17260, Date: "January 3, 2024"}},
+		}
+	}
+	if _, err := s.Save(ctx, order("111-0000000-0000003", "Visa ****1234")); err != nil {
+		t.Fatal(err)
+	}
+
+	orders := []models.Order{
+		order("111-0000000-0000001", "Visa ****1234"),
+		order("111-0000000-0000002", "broken"),
+		order("111-0000000-0000003", "Visa ****5678"),
+	}
+	results, err := s.SaveBatch(ctx, orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(orders) {
+		t.Fatalf("%d results, want %d", len(results), len(orders))
+	}
+	for i, want := range []struct {
+		created, failed bool
+	}{{true, false}, {false, true}, {false, false}} {
+		res := results[i]
+		if res.ID != orders[i].ID || res.Created != want.created || (res.Err != nil) != want.failed {
+			t.Errorf("result %d = %+v, want created %v, failed %v", i, res, want.created, want.failed)
+		}
+	}
+
+	for _, o := range []models.Order{orders[0], orders[2]} {
+		if _, err := s.Load(ctx, o.ID); err != nil {
+			t.Errorf("Load(%s) error = %v", o.ID, err)
+		}
+	}
+	if _, err := s.Load(ctx, orders[1].ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Load(%s) error = %v, want the failed order rolled back", orders[1].ID, err)
+	}
+	for _, table := range []string{"purchase_items", "order_revisions"} {
+		var n int
+		err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+" WHERE purchase_id = ?", orders[1].ID).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("%d %s rows left from the failed order", n, table)
+		}
+	}
+}
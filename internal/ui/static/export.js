@@ -1,4 +1,10 @@
 (async function () {
+  // the bookmarklet from the settings page adds a script tag with our token,
+  // and currentScript is only set until the first await
+  const script = document.currentScript;
+  const token = script?.dataset.token;
+  const server = script ? new URL(script.src).origin : "http://localhost:8080";
+
   const findDate = (row) => {
     let el = row.parentElement.previousElementSibling;
     while (el && !el.classList.contains("apx-transaction-date-container")) {
@@ -12,9 +18,12 @@
       ".apx-transactions-line-item-component-container"
     );
 
-    return Array.from(rows)
+    // split shipments show up as several rows for the same order, so
+    // collect them into one order with several charges
+    const orders = new Map();
+    Array.from(rows)
       .filter((row) => row.children.length > 0)
-      .map((row) => {
+      .forEach((row) => {
         const link = row.querySelector("a");
         const id = link.innerText.replace("Order #", "").trim();
         const href = id.startsWith("D")
@@ -24,16 +33,16 @@
         const amount = parseFloat(
           row.querySelector(".a-span-last").innerText.replace("$", "")
         );
-        return {
-          id,
-          href,
-          charge: {
-            amount,
-            date: findDate(row),
-            card: row.querySelector(".a-text-bold").innerText.trim(),
-          },
-        };
+        if (!orders.has(id)) {
+          orders.set(id, { id, href, charges: [] });
+        }
+        orders.get(id).charges.push({
+          amount,
+          date: findDate(row),
+          card: row.querySelector(".a-text-bold").innerText.trim(),
+        });
       });
+    return Array.from(orders.values());
   };
 
   const withNewWindow = async (url, fn) => {
@@ -44,88 +53,49 @@
     return ret;
   };
 
-  const getItems = (itemHeader) =>
-    Array.from(itemHeader.closest("tbody").querySelectorAll("td i")).map(
-      (x) => x.innerText
-    );
-
-  const scrapeSubscribeAndSave = (doc) => {
-    const headings = Array.from(doc.querySelectorAll("td b"));
-
-    const price = headings
-      .map((x) => x.innerText)
-      .filter((x) => x.startsWith("Order Total: $"))
-      .map((x) => parseFloat(x.replace("Order Total: $", "")))[0];
-
-    const items = headings
-      .filter((x) => x.innerHTML === "Items Ordered")
-      .map(getItems)
-      .flat();
-
-    return { price, items };
-  };
-
-  const scrapeInvoice = (doc) => {
-    const isSubscribeAndSave = Array.from(doc.querySelectorAll("b")).some(
-      (el) => el.innerText.startsWith("Subscribe and Save")
-    );
-
-    if (isSubscribeAndSave) {
-      return scrapeSubscribeAndSave(doc);
-    }
-
-    const price = parseFloat(
-      doc
-        .querySelector(".od-line-item-row:last-child .a-span-last")
-        .innerText.replace("$", "")
-    );
-
-    const items = Array.from(
-      doc.querySelectorAll('[data-component="itemTitle"]')
-    ).map((el) => el.innerText.trim());
-
-    return { items, price };
-  };
-
-  const scrapeDigitalInvoice = (doc) => {
-    const price = parseFloat(
-      (
-        doc.querySelector(".a-color-price") ||
-        [
-          ...doc.querySelectorAll(
-            '[data-component="chargeSummary"] .a-span-last'
-          ),
-        ].pop()
-      ).innerText.replace("$", "")
-    );
-
-    const items = [
-      doc
-        .querySelector('td[valign="top"] b a,[data-component="itemTitle"]')
-        .innerText.trim(),
-    ];
-
-    return { items, price };
-  };
-
+  // the server parses the invoice, so fixing it when Amazon changes the
+  // markup doesn't mean updating everyone's bookmarklet
   const openInvoice = async (order) => {
-    const details = await withNewWindow(
+    const html = await withNewWindow(
       order.href,
-      order.id.startsWith("D") ? scrapeDigitalInvoice : scrapeInvoice
+      (doc) => doc.documentElement.outerHTML
     );
-    return { ...order, ...details };
+    return { ...order, html };
   };
 
+  // problems explains why the server rejected any orders
+  const problems = [];
+
   const upload = async (order) => {
-    const res = await fetch("http://localhost:8080/api/purchases/" + order.id, {
+    const { id, ...body } = order;
+    const res = await fetch(server + "/api/purchases/" + id + "/invoice", {
       method: "PUT",
       mode: "cors",
-      headers: { "Content-Type": "application/json" },
-      body: JSON.stringify(order),
+      headers: {
+        "Content-Type": "application/json",
+        Authorization: "Bearer " + token,
+      },
+      body: JSON.stringify(body),
     });
+    if (
+      res.headers.get("Content-Type")?.startsWith("application/problem+json")
+    ) {
+      const problem = await res.json();
+      const fields = (problem.errors || [])
+        .map((e) => `\n  ${e.field}: ${e.message}`)
+        .join("");
+      problems.push(`${order.id}: ${problem.detail || problem.title}${fields}`);
+    } else if (res.status === 401) {
+      problems.push(
+        `${order.id}: the API token was rejected, make a new bookmarklet on ${server}/settings`
+      );
+    }
     x = {
       200: "👷",
       201: "👶",
+      400: "🧟",
+      401: "🔒",
+      422: "🧟",
       500: "🧟",
       409: "🙅",
     };
@@ -134,6 +104,6 @@
 
   const orders = await Promise.all(getTransactions().map(openInvoice));
   const results = await Promise.all(orders.map(upload));
-  alert(results.join(" "));
+  alert([results.join(" "), ...problems].join("\n\n"));
   document.querySelector(".a-span-last .a-button-input").click();
 })();
@@ -2,17 +2,29 @@ package ui
 
 import (
 	"context"
+	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
 	"html/template"
 	"io/fs"
 	"log"
-	"math"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ryepup/amazon-exporter/internal/auth"
+	"github.com/ryepup/amazon-exporter/internal/autoapprove"
+	"github.com/ryepup/amazon-exporter/internal/classify"
+	"github.com/ryepup/amazon-exporter/internal/match"
 	"github.com/ryepup/amazon-exporter/internal/models"
+	"github.com/ryepup/amazon-exporter/internal/orderhistory"
+	"github.com/ryepup/amazon-exporter/internal/query"
+	"github.com/ryepup/amazon-exporter/internal/rules"
 	discover "github.com/ryepup/ynab-discover"
 )
 
@@ -24,44 +36,112 @@ var (
 )
 
 type Repo interface {
-	Search(context.Context, string) ([]models.Order, error)
-	RecordCategories(context.Context, map[models.TransactionID]models.TransactionUpdate) error
+	Search(context.Context, query.Query) ([]models.SearchResult, error)
+	FindCharges(ctx context.Context, from, to time.Time) ([]models.OrderCharge, error)
+	RecordMatches(context.Context, []models.Match) error
+	Load(ctx context.Context, id string) (models.Order, error)
+	SaveBatch(context.Context, []models.Order) ([]models.SaveResult, error)
+	Revisions(ctx context.Context, id string) ([]models.Revision, error)
+	Rules(context.Context, models.BudgetID) ([]models.Rule, error)
+	SaveRule(context.Context, models.Rule) (int64, error)
+	DeleteRule(ctx context.Context, id int64) error
+	Learn(context.Context, models.BudgetID, []classify.Example) error
+	Classifier(context.Context, models.BudgetID) (*classify.Model, error)
+	SaveAutoApprovals(context.Context, []models.AutoApproval) error
+	AutoApprovals(context.Context) ([]models.AutoApproval, error)
+	AutoApproval(ctx context.Context, id int64) (models.AutoApproval, error)
+	UndoAutoApproval(ctx context.Context, id int64) error
+
+	auth.Store
+	CreateSession(ctx context.Context, hash string, expires time.Time) error
+	DeleteSession(ctx context.Context, hash string) error
+	CreateToken(ctx context.Context, name, hash string) error
+	Tokens(context.Context) ([]models.APIToken, error)
+	DeleteToken(ctx context.Context, id int64) error
 }
 
 type YNAB interface {
 	Unapproved(context.Context, models.BudgetID) ([]models.UnapprovedTransaction, error)
 	Categories(context.Context, models.BudgetID) (map[string][]models.Category, error)
 	Approve(context.Context, models.BudgetID, map[models.TransactionID]models.TransactionUpdate) error
+	Unapprove(context.Context, models.BudgetID, models.UnapprovedTransaction) error
 	Budgets(ctx context.Context) ([]models.Budget, error)
 }
 
+type Config struct {
+	// Password is needed to log in to the UI. It can only be empty if
+	// Insecure is set.
+	Password string
+	// Insecure lets the UI run without a password, so anyone who can reach
+	// the server can use it and make API tokens
+	Insecure bool
+	// Match sets how closely charges have to match YNAB transactions
+	Match match.Config
+	// AutoApprove sets which matches are approved without asking
+	AutoApprove autoapprove.Config
+}
+
 type UI struct {
 	staticServer http.Handler
 	templates    *template.Template
 	repo         Repo
 	ynabRepo     YNAB
+	password     string
+	match        match.Config
+	autoApprove  autoapprove.Config
+	handler      http.Handler
 }
 
-func New(repo Repo, y YNAB) (*UI, error) {
+// sessionLength is how long a login lasts
+const sessionLength = 30 * 24 * time.Hour
+
+// newTokenCookie carries a new API token from the POST that creates it to the
+// settings page it's redirected to, which shows it once
+const newTokenCookie = "new_token"
+
+// ErrNoPassword means the UI would be open to anyone
+var ErrNoPassword = errors.New("no UI password set")
+
+func New(repo Repo, y YNAB, cfg Config) (*UI, error) {
+	if cfg.Password == "" && !cfg.Insecure {
+		return nil, ErrNoPassword
+	}
 	staticFS, err := fs.Sub(static, "static")
 	if err != nil {
 		return nil, fmt.Errorf("failed to make static subtree: %w", err)
 	}
 
-	tmpl, err := template.ParseFS(templateFS, "templates/*.html")
+	tmpl, err := template.New("").Funcs(template.FuncMap{
+		"highlight":       highlight,
+		"categoryOptions": categoryOptions,
+		"percent":         percent,
+	}).ParseFS(templateFS, "templates/*.html")
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	return &UI{
+	u := &UI{
 		staticServer: http.FileServer(http.FS(staticFS)),
 		templates:    tmpl,
 		repo:         repo,
 		ynabRepo:     y,
-	}, nil
+		password:     cfg.Password,
+		match:        cfg.Match,
+		autoApprove:  cfg.AutoApprove,
+	}
+	u.handler = http.HandlerFunc(u.route)
+	if u.password != "" {
+		// the bookmarklet loads export.js from amazon.com, without our cookie
+		u.handler = auth.RequireSession(repo, "/login", []string{"/export.js"}, u.handler)
+	}
+	return u, nil
 }
 
 func (u *UI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.handler.ServeHTTP(w, r)
+}
+
+func (u *UI) route(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.Path {
 	case "/purchases":
 		u.results(w, r)
@@ -71,58 +151,78 @@ func (u *UI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		u.ynab(w, r)
 	case "/discover":
 		u.discover(w, r)
+	case "/import":
+		u.importOrders(w, r)
+	case "/history":
+		u.history(w, r)
+	case "/login":
+		u.login(w, r)
+	case "/logout":
+		u.logout(w, r)
+	case "/rules":
+		u.rules(w, r)
+	case "/auto-approved":
+		u.autoApproved(w, r)
+	case "/settings":
+		u.settings(w, r)
 	default:
 		u.staticServer.ServeHTTP(w, r)
 	}
 }
 
-func (u *UI) index(w http.ResponseWriter, r *http.Request) {
-	templateData := struct {
-		Orders []models.Order
-		Q      string
-	}{}
+// searchResults is the template data for results.html
+type searchResults struct {
+	Orders []models.SearchResult
+	Q      string
+	// Error explains why Q couldn't be parsed
+	Error string
+}
 
-	q := r.URL.Query().Get("q")
-	if q != "" {
-		orders, err := u.repo.Search(r.Context(), q)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		templateData.Orders = orders
-		templateData.Q = q
+// search runs the "q" query parameter, if any. Syntax errors are reported in
+// the results rather than as an error.
+func (u *UI) search(r *http.Request) (searchResults, error) {
+	var res searchResults
+	res.Q = r.URL.Query().Get("q")
+	if res.Q == "" {
+		return res, nil
+	}
+
+	q, err := query.Parse(res.Q)
+	if err != nil {
+		res.Error = err.Error()
+		return res, nil
+	}
+	res.Orders, err = u.repo.Search(r.Context(), q)
+	return res, err
+}
+
+func (u *UI) index(w http.ResponseWriter, r *http.Request) {
+	templateData, err := u.search(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	u.renderPage(w, "index.html", templateData)
 
 }
 
 func (u *UI) results(w http.ResponseWriter, r *http.Request) {
-	templateData := struct {
-		Orders []models.Order
-		Q      string
-	}{}
-
-	q := r.URL.Query().Get("q")
-	if q != "" {
-		orders, err := u.repo.Search(r.Context(), q)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		templateData.Orders = orders
-		templateData.Q = q
+	templateData, err := u.search(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	if err := u.templates.ExecuteTemplate(w, "results.html", templateData); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
-func (u *UI) ynab(w http.ResponseWriter, r *http.Request) {
-
+// budget finds the budget picked with the "budgetID" query parameter, or the
+// most recently modified one
+func (u *UI) budget(r *http.Request) ([]models.Budget, models.BudgetID, error) {
 	budgets, err := u.ynabRepo.Budgets(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, "", err
 	}
 	var budgetID models.BudgetID
 
@@ -135,7 +235,15 @@ func (u *UI) ynab(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if budgetID == models.BudgetID("") {
-		http.Error(w, "could not find budget ID", http.StatusInternalServerError)
+		return nil, "", errors.New("could not find budget ID")
+	}
+	return budgets, budgetID, nil
+}
+
+func (u *UI) ynab(w http.ResponseWriter, r *http.Request) {
+	budgets, budgetID, err := u.budget(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -151,23 +259,108 @@ func (u *UI) ynab(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		idToName := make(map[models.CategoryID]string)
-		for _, group := range cats {
-			for _, cat := range group {
-				idToName[cat.ID] = cat.Name
+		if r.PostForm.Get("action") == "auto-approve" {
+			results, compiled, classifier, err := u.matchUnapproved(r.Context(), budgetID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := u.approveAutomatically(r.Context(), budgetID, results, compiled, classifier); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
 			}
+			http.Redirect(w, r, "/auto-approved", http.StatusFound)
+			return
 		}
+
+		idToName := categoryNames(cats)
 		updates := make(map[models.TransactionID]models.TransactionUpdate)
+		var (
+			matches  []models.Match
+			examples []classify.Example
+			// amounts are the unapproved transactions' amounts, looked up
+			// when there's a split so it adds up to the milliunit
+			amounts map[models.TransactionID]models.Money
+		)
 		for idx, cID := range r.PostForm["categoryID"] {
 			if cID == "-1" {
 				continue
 			}
 			tID := r.PostForm["transactionID"][idx]
-			updates[models.TransactionID(tID)] = models.TransactionUpdate{
+			update := models.TransactionUpdate{
 				CategoryID:   models.CategoryID(cID),
 				Payee:        r.PostForm["payee"][idx],
 				CategoryName: idToName[models.CategoryID(cID)],
+				Memo:         r.PostForm.Get("memo." + tID),
 			}
+
+			// the radio button for which suggested order this was, or a
+			// comma-separated group of orders billed together
+			if orderIDs := r.PostForm.Get("order." + tID); orderIDs != "" {
+				var (
+					items      []models.Item
+					categories []models.Category
+					// byOrder is the categories of each order's items
+					byOrder [][]models.Category
+					split   bool
+				)
+				for orderID := range strings.SplitSeq(orderIDs, ",") {
+					order, err := u.repo.Load(r.Context(), orderID)
+					if err != nil {
+						http.Error(w, err.Error(), http.StatusInternalServerError)
+						return
+					}
+					update.Orders = append(update.Orders, order)
+					cats, s := itemCategories(r.PostForm, tID, order, update, idToName)
+					items = append(items, order.Items...)
+					categories = append(categories, cats...)
+					byOrder = append(byOrder, cats)
+					split = split || s
+				}
+				if split {
+					if amounts == nil {
+						trans, err := u.ynabRepo.Unapproved(r.Context(), budgetID)
+						if err != nil {
+							http.Error(w, err.Error(), http.StatusInternalServerError)
+							return
+						}
+						amounts = make(map[models.TransactionID]models.Money, len(trans))
+						for _, t := range trans {
+							amounts[t.ID] = t.Amount
+						}
+					}
+					amount, ok := amounts[models.TransactionID(tID)]
+					if !ok {
+						http.Error(w, fmt.Sprintf("transaction %s is no longer waiting for approval", tID), http.StatusBadRequest)
+						return
+					}
+					update.Splits = models.SplitItems(amount, items, categories)
+					// every item moved to the same category, so there's
+					// nothing to split
+					if len(update.Splits) == 1 {
+						update.CategoryID = update.Splits[0].CategoryID
+						update.CategoryName = update.Splits[0].CategoryName
+						update.Splits = nil
+					}
+				}
+				for i, item := range items {
+					examples = append(examples, classify.Example{Category: categories[i], Title: item.Title})
+				}
+
+				for i, order := range update.Orders {
+					categoryID, categoryName := matchCategory(byOrder[i], update)
+					matches = append(matches, models.Match{
+						OrderID:       order.ID,
+						TransactionID: models.TransactionID(tID),
+						BudgetID:      budgetID,
+						CategoryID:    categoryID,
+						CategoryName:  categoryName,
+						Payee:         update.Payee,
+						ApprovedAt:    time.Now(),
+					})
+				}
+			}
+			updates[models.TransactionID(tID)] = update
 		}
 
 		if err := u.ynabRepo.Approve(r.Context(), budgetID, updates); err != nil {
@@ -175,7 +368,12 @@ func (u *UI) ynab(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := u.repo.RecordCategories(r.Context(), updates); err != nil {
+		if err := u.repo.RecordMatches(r.Context(), matches); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := u.repo.Learn(r.Context(), budgetID, examples); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -186,7 +384,12 @@ func (u *UI) ynab(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	trans, err := u.ynabRepo.Unapproved(r.Context(), budgetID)
+	results, compiled, classifier, err := u.matchUnapproved(r.Context(), budgetID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	confident, err := u.autoApprovals(r.Context(), budgetID, results, compiled, classifier)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -194,7 +397,28 @@ func (u *UI) ynab(w http.ResponseWriter, r *http.Request) {
 
 	type unapproved struct {
 		models.UnapprovedTransaction
-		Orders []models.Order
+		Orders []match.Candidate
+		// Groups are sets of orders billed together that add up to the
+		// transaction
+		Groups []match.Group
+		// OrderSuggestions are the likely categories of each order, by ID, and
+		// of each group, by its order IDs
+		OrderSuggestions map[string][]classify.Suggestion
+		// ItemSuggestions are the likely categories of each item, by order ID
+		// and then position
+		ItemSuggestions map[string][][]classify.Suggestion
+		// Suggestions are the likely categories of the pre-selected order
+		Suggestions []classify.Suggestion
+		// Rule is the first rule that matched, if any
+		Rule *rules.Rule
+		// OrderID is the order to pre-select: the one proposed by the
+		// matcher, or the group of orders it proposed, or else the one the
+		// rule matched
+		OrderID string
+		// Ambiguous means the matcher couldn't tell which order it is
+		Ambiguous bool
+		// CategoryID is the category to pre-select
+		CategoryID models.CategoryID
 	}
 
 	templateData := struct {
@@ -202,37 +426,538 @@ func (u *UI) ynab(w http.ResponseWriter, r *http.Request) {
 		Categories   map[string][]models.Category
 		Budgets      []models.Budget
 		BudgetID     models.BudgetID
+		// Confident is how many transactions can be approved
+		// automatically
+		Confident int
 	}{
 		Categories:   cats,
-		Transactions: make([]unapproved, 0, len(trans)),
+		Transactions: make([]unapproved, 0, len(results)),
 		Budgets:      budgets,
 		BudgetID:     budgetID,
+		Confident:    len(confident),
 	}
-	for _, ut := range trans {
-		ut := ut
-		orders, err := u.repo.Search(r.Context(), fmt.Sprintf("%.2f", math.Abs(ut.Amount)))
+	for _, res := range results {
+		ut := res.Transaction
+		t := unapproved{
+			UnapprovedTransaction: ut,
+			Orders:                res.Candidates,
+			OrderSuggestions:      make(map[string][]classify.Suggestion, len(res.Candidates)),
+			ItemSuggestions:       make(map[string][][]classify.Suggestion, len(res.Candidates)),
+			Ambiguous:             res.Ambiguous,
+			Groups:                res.Groups,
+		}
+		if res.Proposed >= 0 {
+			t.OrderID = res.Candidates[res.Proposed].ID
+		}
+		for _, g := range res.Groups {
+			if g.Proposed {
+				t.OrderID = g.OrderIDs()
+			}
+			var items []models.Item
+			for _, oc := range g.Charges {
+				items = append(items, oc.Items...)
+			}
+			t.OrderSuggestions[g.OrderIDs()] = topSuggestions(classifier.Rank(items))
+		}
+		// rules skip the charges proposed for other transactions
+		var available []models.OrderCharge
+		for _, c := range res.Candidates {
+			if !c.Elsewhere {
+				available = append(available, c.OrderCharge)
+			}
+		}
+		for _, o := range res.Candidates {
+			t.OrderSuggestions[o.ID] = topSuggestions(classifier.Rank(o.Items))
+			items := make([][]classify.Suggestion, len(o.Items))
+			for i, item := range o.Items {
+				items[i] = topSuggestions(classifier.Rank([]models.Item{item}))
+			}
+			t.ItemSuggestions[o.ID] = items
+		}
+		var order *models.OrderCharge
+		if t.Rule, order = rules.Suggest(compiled, ut, available); t.Rule != nil {
+			t.CategoryID = t.Rule.CategoryID
+			if order != nil && t.OrderID == "" {
+				t.OrderID = order.ID
+			}
+		}
+		t.Suggestions = t.OrderSuggestions[t.OrderID]
+		templateData.Transactions = append(templateData.Transactions, t)
+	}
+	u.renderPage(w, "ynab.html", templateData)
+}
+
+// matchUnapproved matches a budget's unapproved transactions to the saved
+// orders, and loads the rules and learned suggestions that pick categories
+func (u *UI) matchUnapproved(ctx context.Context, budgetID models.BudgetID) ([]match.Result, []*rules.Rule, *classify.Model, error) {
+	trans, err := u.ynabRepo.Unapproved(ctx, budgetID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	saved, err := u.repo.Rules(ctx, budgetID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	compiled, err := rules.CompileAll(saved)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	classifier, err := u.repo.Classifier(ctx, budgetID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	from, to := u.match.Between(trans)
+	charges, err := u.repo.FindCharges(ctx, from, to)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return u.match.Match(trans, charges), compiled, classifier, nil
+}
+
+// autoApprovals picks the matches autoapprove is sure about. Transactions
+// that were undone are left for someone to approve by hand.
+func (u *UI) autoApprovals(ctx context.Context, budgetID models.BudgetID, results []match.Result, rs []*rules.Rule, classifier *classify.Model) ([]models.AutoApproval, error) {
+	if !u.autoApprove.Enabled() {
+		return nil, nil
+	}
+	previous, err := u.repo.AutoApprovals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results = slices.DeleteFunc(slices.Clone(results), func(res match.Result) bool {
+		return slices.ContainsFunc(previous, func(a models.AutoApproval) bool { return a.Transaction.ID == res.Transaction.ID })
+	})
+	return u.autoApprove.Decide(budgetID, results, rs, classifier), nil
+}
+
+// approveAutomatically approves the matches that autoapprove picks, and
+// records them so they can be undone
+func (u *UI) approveAutomatically(ctx context.Context, budgetID models.BudgetID, results []match.Result, rs []*rules.Rule, classifier *classify.Model) error {
+	approvals, err := u.autoApprovals(ctx, budgetID, results, rs, classifier)
+	if err != nil || len(approvals) == 0 {
+		return err
+	}
+
+	updates := make(map[models.TransactionID]models.TransactionUpdate, len(approvals))
+	matches := make([]models.Match, len(approvals))
+	for i, a := range approvals {
+		order, err := u.repo.Load(ctx, a.OrderID)
 		if err != nil {
+			return err
+		}
+		updates[a.Transaction.ID] = models.TransactionUpdate{
+			Payee:        a.Payee,
+			CategoryID:   a.CategoryID,
+			CategoryName: a.CategoryName,
+			Orders:       []models.Order{order},
+			Memo:         a.Transaction.Memo,
+		}
+		matches[i] = models.Match{
+			OrderID:       a.OrderID,
+			TransactionID: a.Transaction.ID,
+			BudgetID:      budgetID,
+			CategoryID:    a.CategoryID,
+			CategoryName:  a.CategoryName,
+			Payee:         a.Payee,
+			ApprovedAt:    a.ApprovedAt,
+		}
+	}
+
+	if err := u.ynabRepo.Approve(ctx, budgetID, updates); err != nil {
+		return err
+	}
+	if err := u.repo.RecordMatches(ctx, matches); err != nil {
+		return err
+	}
+	if err := u.repo.SaveAutoApprovals(ctx, approvals); err != nil {
+		return err
+	}
+	return nil
+}
+
+// autoApproved lists the transactions that were approved automatically, and
+// undoes them
+func (u *UI) autoApproved(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a, err := u.repo.AutoApproval(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		u := unapproved{
-			UnapprovedTransaction: ut,
+		if a.UndoneAt.IsZero() {
+			if err := u.ynabRepo.Unapprove(r.Context(), a.BudgetID, a.Transaction); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := u.repo.UndoAutoApproval(r.Context(), id); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		http.Redirect(w, r, r.URL.Path, http.StatusFound)
+		return
+	}
+
+	approvals, err := u.repo.AutoApprovals(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	u.renderPage(w, "auto-approved.html", struct {
+		Approvals []models.AutoApproval
+		Enabled   bool
+		Config    autoapprove.Config
+	}{approvals, u.autoApprove.Enabled(), u.autoApprove})
+}
+
+// categoryNames maps the IDs of a budget's categories to their names
+func categoryNames(cats map[string][]models.Category) map[models.CategoryID]string {
+	idToName := make(map[models.CategoryID]string)
+	for _, group := range cats {
+		for _, cat := range group {
+			idToName[cat.ID] = cat.Name
+		}
+	}
+	return idToName
+}
+
+// matchCategory is the category an order's approval is recorded under: the
+// one its items went into, or no ID and a name listing them all when its items
+// were split between categories.
+func matchCategory(categories []models.Category, update models.TransactionUpdate) (models.CategoryID, string) {
+	var distinct []models.Category
+	for _, c := range categories {
+		if !slices.Contains(distinct, c) {
+			distinct = append(distinct, c)
+		}
+	}
+	switch len(distinct) {
+	case 0:
+		return update.CategoryID, update.CategoryName
+	case 1:
+		return distinct[0].ID, distinct[0].Name
+	}
+	names := make([]string, len(distinct))
+	for i, c := range distinct {
+		names[i] = c.Name
+	}
+	return "", "Split (" + strings.Join(names, ", ") + ")"
+}
+
+// itemCategories reads the per-item categories chosen for the order a
+// transaction paid for. Items left alone get the transaction's category. It
+// reports whether any item ended up in a different category.
+func itemCategories(form url.Values, tID string, order models.Order, update models.TransactionUpdate, idToName map[models.CategoryID]string) (categories []models.Category, split bool) {
+	prefix := "split." + tID + "." + order.ID + "."
+	categories = make([]models.Category, len(order.Items))
+	for i := range order.Items {
+		c := models.Category{ID: update.CategoryID, Name: update.CategoryName}
+		if cID := models.CategoryID(form.Get(prefix + strconv.Itoa(i))); cID != "" && cID != update.CategoryID {
+			c = models.Category{ID: cID, Name: idToName[cID]}
+			split = true
 		}
-		for _, o := range orders {
-			t, err := o.Charge.Time()
+		categories[i] = c
+	}
+	return categories, split
+}
+
+// rulePreviewWindow is how far back rule previews look for charges
+const rulePreviewWindow = 365 * 24 * time.Hour
+
+// rules lists a budget's rules, and adds, deletes or previews them. Previews
+// show what a rule would have matched in the last year of saved charges.
+func (u *UI) rules(w http.ResponseWriter, r *http.Request) {
+	budgets, budgetID, err := u.budget(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cats, err := u.ynabRepo.Categories(r.Context(), budgetID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	templateData := struct {
+		Budgets    []models.Budget
+		BudgetID   models.BudgetID
+		Categories map[string][]models.Category
+		Rules      []models.Rule
+		// Form is the rule being added or previewed
+		Form      models.Rule
+		Error     string
+		Previewed bool
+		Preview   []rules.Hit
+	}{
+		Budgets:    budgets,
+		BudgetID:   budgetID,
+		Categories: cats,
+	}
+	self := "/rules?" + url.Values{"budgetID": []string{budgetID.String()}}.Encode()
+
+	if r.Method == http.MethodPost {
+		switch action := r.PostFormValue("action"); action {
+		case "create", "preview":
+			rule, err := ruleForm(r, budgetID, categoryNames(cats))
+			templateData.Form = rule
 			if err != nil {
-				log.Printf("ignoring order %s, bad date %s", o.ID, o.Charge.Date)
-				continue
+				templateData.Error = err.Error()
+				break
+			}
+			compiled, err := rules.Compile(rule)
+			if err != nil {
+				templateData.Error = err.Error()
+				break
+			}
+			if action == "preview" {
+				now := time.Now()
+				charges, err := u.repo.FindCharges(r.Context(), now.Add(-rulePreviewWindow), now)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				templateData.Previewed = true
+				templateData.Preview = rules.Preview(compiled, charges)
+				break
+			}
+			if _, err := u.repo.SaveRule(r.Context(), rule); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, self, http.StatusFound)
+			return
+		case "delete":
+			id, err := strconv.ParseInt(r.PostFormValue("id"), 10, 64)
+			if err != nil {
+				http.Error(w, "invalid rule id", http.StatusBadRequest)
+				return
 			}
-			diff := ut.Date.Sub(t).Abs()
-			if diff < 72*time.Hour {
-				u.Orders = append(u.Orders, o)
+			if err := u.repo.DeleteRule(r.Context(), id); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
 			}
+			http.Redirect(w, r, self, http.StatusFound)
+			return
+		default:
+			http.Error(w, "unknown action", http.StatusBadRequest)
+			return
 		}
+	}
 
-		templateData.Transactions = append(templateData.Transactions, u)
+	templateData.Rules, err = u.repo.Rules(r.Context(), budgetID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	u.renderPage(w, "ynab.html", templateData)
+	u.renderPage(w, "rules.html", templateData)
+}
+
+// ruleForm reads a rule from the form on the rules page
+func ruleForm(r *http.Request, budgetID models.BudgetID, idToName map[models.CategoryID]string) (models.Rule, error) {
+	rule := models.Rule{
+		BudgetID:     budgetID,
+		TitlePattern: strings.TrimSpace(r.PostFormValue("titlePattern")),
+		Card:         strings.TrimSpace(r.PostFormValue("card")),
+		PayeePattern: strings.TrimSpace(r.PostFormValue("payeePattern")),
+		CategoryID:   models.CategoryID(r.PostFormValue("categoryID")),
+		PayeeName:    strings.TrimSpace(r.PostFormValue("payeeName")),
+	}
+	rule.CategoryName = idToName[rule.CategoryID]
+	for _, f := range []struct {
+		name string
+		dest *models.Money
+	}{{"minAmount", &rule.MinAmount}, {"maxAmount", &rule.MaxAmount}} {
+		v := strings.TrimSpace(r.PostFormValue(f.name))
+		if v == "" {
+			continue
+		}
+		amount, err := models.ParseMoney(v)
+		if err != nil {
+			return rule, fmt.Errorf("%s: %w", f.name, err)
+		}
+		*f.dest = amount
+	}
+	return rule, nil
+}
+
+// history shows the revisions of the order in the "id" query parameter
+func (u *UI) history(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	order, err := u.repo.Load(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	revisions, err := u.repo.Revisions(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// newest first
+	slices.Reverse(revisions)
+
+	u.renderPage(w, "history.html", struct {
+		Order     models.Order
+		Orders    []models.SearchResult
+		Revisions []models.Revision
+	}{order, []models.SearchResult{{Order: order}}, revisions})
+}
+
+// login checks the password and starts a session
+func (u *UI) login(w http.ResponseWriter, r *http.Request) {
+	if u.password == "" {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		u.renderPage(w, "login.html", nil)
+		return
+	}
+
+	if !auth.PasswordMatches(r.PostFormValue("password"), u.password) {
+		w.WriteHeader(http.StatusUnauthorized)
+		u.renderPage(w, "login.html", struct{ Error string }{"wrong password"})
+		return
+	}
+
+	id, hash, err := auth.NewSecret()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	expires := time.Now().Add(sessionLength)
+	if err := u.repo.CreateSession(r.Context(), hash, expires); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// SameSite keeps other sites from posting forms here with our session
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.SessionCookie,
+		Value:    id,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (u *UI) logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if c, err := r.Cookie(auth.SessionCookie); err == nil {
+		if err := u.repo.DeleteSession(r.Context(), auth.Hash(c.Value)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: auth.SessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+// settings manages API tokens. A new token is only shown once, on the page
+// the create form redirects to, baked into a bookmarklet, so reloading that
+// page doesn't create another.
+func (u *UI) settings(w http.ResponseWriter, r *http.Request) {
+	var templateData struct {
+		Tokens      []models.APIToken
+		NewToken    string
+		Bookmarklet template.URL
+		LoggedIn    bool
+	}
+	templateData.LoggedIn = u.password != ""
+
+	if r.Method == http.MethodPost {
+		switch r.PostFormValue("action") {
+		case "create":
+			name := strings.TrimSpace(r.PostFormValue("name"))
+			if name == "" {
+				name = "bookmarklet"
+			}
+			token, hash, err := auth.NewSecret()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := u.repo.CreateToken(r.Context(), name, hash); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     newTokenCookie,
+				Value:    token,
+				Path:     "/settings",
+				MaxAge:   60,
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		case "delete":
+			id, err := strconv.ParseInt(r.PostFormValue("id"), 10, 64)
+			if err != nil {
+				http.Error(w, "invalid token id", http.StatusBadRequest)
+				return
+			}
+			if err := u.repo.DeleteToken(r.Context(), id); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, "/settings", http.StatusFound)
+			return
+		default:
+			http.Error(w, "unknown action", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if c, err := r.Cookie(newTokenCookie); err == nil && c.Value != "" {
+		http.SetCookie(w, &http.Cookie{Name: newTokenCookie, Path: "/settings", MaxAge: -1})
+		// keep the token out of the browser's cache and history
+		w.Header().Set("Cache-Control", "no-store")
+		templateData.NewToken = c.Value
+		templateData.Bookmarklet = bookmarklet(serverURL(r), c.Value)
+	}
+
+	var err error
+	templateData.Tokens, err = u.repo.Tokens(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	u.renderPage(w, "settings.html", templateData)
+}
+
+// serverURL is how the browser reached us, like http://localhost:8080
+func serverURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// bookmarklet loads export.js from the server, passing along the API token
+func bookmarklet(server, token string) template.URL {
+	return template.URL(fmt.Sprintf(
+		"javascript:(function(){var s=document.createElement('script');"+
+			"s.src=%q;s.dataset.token=%q;document.body.appendChild(s);}());",
+		server+"/export.js", token))
 }
 
 func (u *UI) discover(w http.ResponseWriter, r *http.Request) {
@@ -266,6 +991,55 @@ func (u *UI) discover(w http.ResponseWriter, r *http.Request) {
 	u.renderPage(w, "discover.html", nil)
 }
 
+// importOrders loads Retail.OrderHistory CSV files from Amazon's data export
+func (u *UI) importOrders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		u.renderPage(w, "import.html", nil)
+		return
+	}
+
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	type fileResult struct {
+		Name             string
+		Error            string
+		Created, Updated int
+		Failed           []models.SaveResult
+	}
+	var templateData struct{ Files []fileResult }
+	for _, header := range r.MultipartForm.File["order_history"] {
+		res := fileResult{Name: header.Filename}
+		results, err := u.importFile(r.Context(), header)
+		if err != nil {
+			res.Error = err.Error()
+		}
+		for _, saved := range results {
+			switch {
+			case saved.Err != nil:
+				res.Failed = append(res.Failed, saved)
+			case saved.Created:
+				res.Created++
+			default:
+				res.Updated++
+			}
+		}
+		templateData.Files = append(templateData.Files, res)
+	}
+	u.renderPage(w, "import.html", templateData)
+}
+
+func (u *UI) importFile(ctx context.Context, header *multipart.FileHeader) ([]models.SaveResult, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return orderhistory.Import(ctx, u.repo, file)
+}
+
 func (u *UI) renderPage(w http.ResponseWriter, page string, templateData any) {
 	p, err := u.templates.Clone()
 	if err != nil {
@@ -279,3 +1053,34 @@ func (u *UI) renderPage(w http.ResponseWriter, page string, templateData any) {
 	}
 
 }
+
+// categoryOptions is the data for category-options.html. The suggested
+// categories, if any, are listed first.
+func categoryOptions(categories map[string][]models.Category, selected models.CategoryID, suggested []classify.Suggestion) any {
+	return struct {
+		Categories map[string][]models.Category
+		Selected   models.CategoryID
+		Suggested  []classify.Suggestion
+	}{categories, selected, suggested}
+}
+
+// maxSuggestions is how many suggested categories to show
+const maxSuggestions = 3
+
+// topSuggestions trims suggestions down to the few worth showing
+func topSuggestions(suggestions []classify.Suggestion) []classify.Suggestion {
+	return suggestions[:min(len(suggestions), maxSuggestions)]
+}
+
+// percent formats a probability, like 0.8 as 80%
+func percent(p float64) string {
+	return fmt.Sprintf("%.0f%%", p*100)
+}
+
+// highlight escapes s for HTML and marks up the terms a search matched.
+func highlight(s string) template.HTML {
+	s = template.HTMLEscapeString(s)
+	s = strings.ReplaceAll(s, models.HighlightStart, "<mark>")
+	s = strings.ReplaceAll(s, models.HighlightEnd, "</mark>")
+	return template.HTML(s)
+}
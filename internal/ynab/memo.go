@@ -0,0 +1,66 @@
+package ynab
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+// MemoLimit is the most characters YNAB accepts in a transaction memo
+const MemoLimit = 500
+
+// DefaultMemo is the memo template used unless the config has another. It
+// gets the matched models.Order; a transaction that paid for several orders
+// gets one per order, separated by " | ". The link comes before the items so
+// that truncating the memo only loses items.
+const DefaultMemo = `{{ .ID }} {{ .Href }} {{ range $i, $item := .Items }}{{ if $i }}; {{ end }}{{ short 40 $item.Title }}{{ end }}`
+
+var memoFuncs = template.FuncMap{
+	"short": short,
+}
+
+func parseMemo(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	t, err := template.New("memo").Funcs(memoFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid memo template: %w", err)
+	}
+	return t, nil
+}
+
+// memo renders the memo for an update. To leave the memo alone it returns the
+// current one, since the API would clear a missing memo.
+func (y *YNAB) memo(update models.TransactionUpdate) (*string, error) {
+	if y.memoTemplate == nil || len(update.Orders) == 0 {
+		return &update.Memo, nil
+	}
+	if y.keepMemo && update.Memo != "" {
+		return &update.Memo, nil
+	}
+	memos := make([]string, len(update.Orders))
+	for i, o := range update.Orders {
+		var sb strings.Builder
+		if err := y.memoTemplate.Execute(&sb, o); err != nil {
+			return nil, fmt.Errorf("memo for order %s: %w", o.ID, err)
+		}
+		memos[i] = strings.Join(strings.Fields(sb.String()), " ")
+	}
+	memo := short(MemoLimit, strings.Join(memos, " | "))
+	return &memo, nil
+}
+
+// short truncates s to at most n characters, marking the cut with an ellipsis
+func short(n int, s string) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	} else if n < 1 {
+		return ""
+	}
+	r := []rune(s)[:n-1]
+	return strings.TrimSpace(string(r)) + "…"
+}
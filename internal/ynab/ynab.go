@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"slices"
+	"text/template"
 
 	"github.com/google/uuid"
 	"github.com/ryepup/amazon-exporter/internal/models"
@@ -23,12 +24,19 @@ func WithAuthorization(token string) ClientOption {
 
 type Config struct {
 	Token, Server string
+	// Memo is the template for the memo of transactions matched to an
+	// order, see DefaultMemo. If empty, memos are left alone.
+	Memo string
+	// KeepMemo leaves memos that are already filled in alone
+	KeepMemo bool
 }
 
 type YNAB struct {
-	client     *ClientWithResponses
-	categories map[models.BudgetID]map[string][]models.Category // cache the categories
-	budgets    []models.Budget                                  // cache the budgets
+	client       *ClientWithResponses
+	memoTemplate *template.Template
+	keepMemo     bool
+	categories   map[models.BudgetID]map[string][]models.Category // cache the categories
+	budgets      []models.Budget                                  // cache the budgets
 }
 
 func New(cfg Config) (*YNAB, error) {
@@ -40,9 +48,15 @@ func New(cfg Config) (*YNAB, error) {
 	if err != nil {
 		return nil, err
 	}
+	memo, err := parseMemo(cfg.Memo)
+	if err != nil {
+		return nil, err
+	}
 
 	return &YNAB{
-		client: c,
+		client:       c,
+		memoTemplate: memo,
+		keepMemo:     cfg.KeepMemo,
 	}, nil
 }
 
@@ -59,10 +73,14 @@ func (y *YNAB) Unapproved(ctx context.Context, budgetID models.BudgetID) (ret []
 
 	for _, td := range res.JSON200.Data.Transactions {
 		ret = append(ret, models.UnapprovedTransaction{
-			ID:     models.TransactionID(td.Id),
-			Amount: float64(td.Amount) / 1000,
-			Date:   td.Date.Time,
-			Payee:  first(td.ImportPayeeName, td.ImportPayeeNameOriginal, td.PayeeName),
+			ID:         models.TransactionID(td.Id),
+			Amount:     models.Money(td.Amount),
+			Date:       td.Date.Time,
+			Payee:      first(td.ImportPayeeName, td.ImportPayeeNameOriginal, td.PayeeName),
+			Memo:       first(td.Memo),
+			Account:    td.AccountName,
+			PayeeName:  first(td.PayeeName),
+			CategoryID: categoryID(td.CategoryId),
 		})
 	}
 	return ret, nil
@@ -113,16 +131,35 @@ func (y *YNAB) Approve(ctx context.Context, budgetID models.BudgetID, items map[
 	}
 	updates := UpdateTransactionsJSONRequestBody{}
 	for ti, update := range items {
-		ci, err := uuid.Parse(update.CategoryID.String())
+		t := SaveTransactionWithIdOrImportId{
+			Id:        ptr(ti.String()),
+			Approved:  ptr(true),
+			PayeeName: &update.Payee,
+		}
+		memo, err := y.memo(update)
 		if err != nil {
 			return err
 		}
-		updates.Transactions = append(updates.Transactions, SaveTransactionWithIdOrImportId{
-			Id:         ptr(ti.String()),
-			Approved:   ptr(true),
-			CategoryId: &ci,
-			PayeeName:  &update.Payee,
-		})
+		t.Memo = memo
+		if len(update.Splits) > 0 {
+			// a split has no category of its own
+			subs := make([]SaveSubTransaction, len(update.Splits))
+			for i, split := range update.Splits {
+				ci, err := uuid.Parse(split.CategoryID.String())
+				if err != nil {
+					return err
+				}
+				subs[i] = SaveSubTransaction{Amount: int64(split.Amount), CategoryId: &ci}
+			}
+			t.Subtransactions = &subs
+		} else {
+			ci, err := uuid.Parse(update.CategoryID.String())
+			if err != nil {
+				return err
+			}
+			t.CategoryId = &ci
+		}
+		updates.Transactions = append(updates.Transactions, t)
 	}
 
 	res, err := y.client.UpdateTransactionsWithResponse(ctx, budgetID.String(), updates)
@@ -136,6 +173,37 @@ func (y *YNAB) Approve(ctx context.Context, budgetID models.BudgetID, items map[
 	return nil
 }
 
+// Unapprove puts a transaction back how it was before it was approved
+func (y *YNAB) Unapprove(ctx context.Context, budgetID models.BudgetID, t models.UnapprovedTransaction) error {
+	// the category is always sent, null if there wasn't one, to clear the
+	// category it was approved with
+	var category *uuid.UUID
+	if t.CategoryID != "" {
+		ci, err := uuid.Parse(t.CategoryID.String())
+		if err != nil {
+			return err
+		}
+		category = &ci
+	}
+	update := SaveTransactionWithIdOrImportId{
+		Id:         ptr(t.ID.String()),
+		Approved:   ptr(false),
+		CategoryId: category,
+		PayeeName:  &t.PayeeName,
+		Memo:       &t.Memo,
+	}
+	res, err := y.client.UpdateTransactionsWithResponse(ctx, budgetID.String(), UpdateTransactionsJSONRequestBody{
+		Transactions: []SaveTransactionWithIdOrImportId{update},
+	})
+	if err != nil {
+		return err
+	}
+	if res.StatusCode() != http.StatusOK {
+		return fmt.Errorf("could not update: %d", res.StatusCode())
+	}
+	return nil
+}
+
 func (y *YNAB) Budgets(ctx context.Context) ([]models.Budget, error) {
 	if len(y.budgets) > 0 {
 		return y.budgets, nil
@@ -175,6 +243,13 @@ func (y *YNAB) Budgets(ctx context.Context) ([]models.Budget, error) {
 
 func ptr[T any](val T) *T { return &val }
 
+func categoryID(id *uuid.UUID) models.CategoryID {
+	if id == nil {
+		return ""
+	}
+	return models.CategoryID(id.String())
+}
+
 func first[T any](opts ...*T) (ret T) {
 	for _, v := range opts {
 		if v != nil {
@@ -0,0 +1,218 @@
+package ynab
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/ryepup/amazon-exporter/internal/models"
+)
+
+func TestUnapprove(t *testing.T) {
+	tests := []struct {
+		name       string
+		categoryID models.CategoryID
+		// want is the category_id sent to YNAB
+		want any
+	}{
+		{"with a category", "22222222-2222-2222-2222-222222222222", "22222222-2222-2222-2222-222222222222"},
+		{"uncategorized", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body struct {
+				Transactions []map[string]any `json:"transactions"`
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Error(err)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"data":{"transaction_ids":[],"server_knowledge":1}}`))
+			}))
+			defer srv.Close()
+
+			y, err := New(Config{Server: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = y.Unapprove(context.Background(), "b", models.UnapprovedTransaction{
+				ID:         "t",
+				PayeeName:  "AMZN Mktp",
+				CategoryID: tt.categoryID,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Transactions) != 1 {
+				t.Fatalf("sent %+v", body)
+			}
+			got, ok := body.Transactions[0]["category_id"]
+			if !ok || got != tt.want {
+				t.Errorf("category_id = %v (sent %v), want %v", got, ok, tt.want)
+			}
+			if body.Transactions[0]["approved"] != false {
+				t.Errorf("approved = %v", body.Transactions[0]["approved"])
+			}
+		})
+	}
+}
+
+func TestShort(t *testing.T) {
+	tests := []struct {
+		n    int
+		s    string
+		want string
+	}{
+		{10, "Coffee", "Coffee"},
+		{6, "Coffee", "Coffee"},
+		{5, "Coffee", "Coff…"},
+		{7, "Coffee, Medium Roast", "Coffee…"},
+		{1, "Coffee", "…"},
+		{0, "Coffee", ""},
+		{0, "", ""},
+		// runes, not bytes
+		{5, "Café au lait", "Café…"},
+		{4, "日本のお茶", "日本の…"},
+		{5, "日本のお茶", "日本のお茶"},
+	}
+	for _, tt := range tests {
+		got := short(tt.n, tt.s)
+		if got != tt.want {
+			t.Errorf("short(%d, %q) = %q, want %q", tt.n, tt.s, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("short(%d, %q) = %q, not valid UTF-8", tt.n, tt.s, got)
+		}
+	}
+}
+
+func TestMemo(t *testing.T) {
+	coffee := models.Order{
+		ID:   "111-1234567-1234567",
+		Href: "https://www.amazon.com/gp/css/summary/print.html?orderID=111-1234567-1234567",
+		Items: []models.Item{
+			{Title: "Ground Coffee, Medium Roast, 12 Ounce (Pack of 2), Rainforest Alliance Certified"},
+			{Title: "Dish Soap"},
+		},
+	}
+	soap := models.Order{ID: "112-7654321-7654321", Href: "https://example.com/112", Items: []models.Item{{Title: "Dish Soap"}}}
+	// an order whose items alone overflow the limit, in multibyte runes
+	long := models.Order{ID: "113-0000000-0000000", Href: "https://example.com/113"}
+	for range 30 {
+		long.Items = append(long.Items, models.Item{Title: strings.Repeat("茶", 40)})
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		keepMemo bool
+		update   models.TransactionUpdate
+		want     string
+	}{
+		{
+			name:     "default template",
+			template: DefaultMemo,
+			update:   models.TransactionUpdate{Orders: []models.Order{coffee}},
+			want:     coffee.ID + " " + coffee.Href + " Ground Coffee, Medium Roast, 12 Ounce (…; Dish Soap",
+		},
+		{
+			name:     "several orders",
+			template: DefaultMemo,
+			update:   models.TransactionUpdate{Orders: []models.Order{coffee, soap}},
+			want:     coffee.ID + " " + coffee.Href + " Ground Coffee, Medium Roast, 12 Ounce (…; Dish Soap | " + soap.ID + " " + soap.Href + " Dish Soap",
+		},
+		{
+			name:     "whitespace collapsed",
+			template: "{{ .ID }}\n\n  {{ range .Items }}{{ .Title }}\n{{ end }}",
+			update:   models.TransactionUpdate{Orders: []models.Order{soap}},
+			want:     soap.ID + " Dish Soap",
+		},
+		{
+			name:     "replaces the memo",
+			template: DefaultMemo,
+			update:   models.TransactionUpdate{Memo: "from the bank", Orders: []models.Order{soap}},
+			want:     soap.ID + " " + soap.Href + " Dish Soap",
+		},
+		{
+			name:     "keeps a memo",
+			template: DefaultMemo,
+			keepMemo: true,
+			update:   models.TransactionUpdate{Memo: "from the bank", Orders: []models.Order{soap}},
+			want:     "from the bank",
+		},
+		{
+			name:     "fills in an empty memo when keeping memos",
+			template: DefaultMemo,
+			keepMemo: true,
+			update:   models.TransactionUpdate{Orders: []models.Order{soap}},
+			want:     soap.ID + " " + soap.Href + " Dish Soap",
+		},
+		{
+			name:   "no template leaves the memo alone",
+			update: models.TransactionUpdate{Memo: "from the bank", Orders: []models.Order{soap}},
+			want:   "from the bank",
+		},
+		{
+			name:     "no order leaves the memo alone",
+			template: DefaultMemo,
+			update:   models.TransactionUpdate{Memo: "from the bank"},
+			want:     "from the bank",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			y, err := New(Config{Memo: tt.template, KeepMemo: tt.keepMemo})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := y.memo(tt.update)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == nil {
+				t.Fatal("memo = nil, which would clear it")
+			}
+			if *got != tt.want {
+				t.Errorf("memo = %q, want %q", *got, tt.want)
+			}
+		})
+	}
+
+	t.Run("cut to the limit", func(t *testing.T) {
+		y, err := New(Config{Memo: DefaultMemo})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := y.memo(models.TransactionUpdate{Orders: []models.Order{long}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := utf8.RuneCountInString(*got); n != MemoLimit {
+			t.Errorf("memo is %d characters, want %d", n, MemoLimit)
+		}
+		if !utf8.ValidString(*got) {
+			t.Error("memo was cut inside a rune")
+		}
+		if !strings.HasPrefix(*got, long.ID+" "+long.Href+" ") || !strings.HasSuffix(*got, "…") {
+			t.Errorf("memo = %q, want the order and link first and an ellipsis last", *got)
+		}
+	})
+
+	t.Run("bad template", func(t *testing.T) {
+		if _, err := New(Config{Memo: "{{ .ID "}); err == nil {
+			t.Error("New() accepted an unparseable memo template")
+		}
+		y, err := New(Config{Memo: "{{ .Missing }}"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := y.memo(models.TransactionUpdate{Orders: []models.Order{soap}}); err == nil {
+			t.Error("memo() rendered a template with an unknown field")
+		}
+	})
+}
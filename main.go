@@ -1,13 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"regexp"
+	"strings"
 
 	"github.com/ryepup/amazon-exporter/internal/api"
+	"github.com/ryepup/amazon-exporter/internal/autoapprove"
+	"github.com/ryepup/amazon-exporter/internal/invoice"
+	"github.com/ryepup/amazon-exporter/internal/match"
+	"github.com/ryepup/amazon-exporter/internal/models"
+	"github.com/ryepup/amazon-exporter/internal/orderhistory"
 	"github.com/ryepup/amazon-exporter/internal/store"
 	"github.com/ryepup/amazon-exporter/internal/ui"
 	"github.com/ryepup/amazon-exporter/internal/ynab"
@@ -15,12 +24,35 @@ import (
 )
 
 var (
-	portFlag   = flag.Int("port", 8080, "Port for the HTTP server")
-	dbFileFlag = flag.String("dbfile", "example.db", "SQLite database file")
-	ynabToken  = flag.String("ynab-token", os.Getenv("YNAB_TOKEN"), "YNAB access token, can specify with YNAB_TOKEN")
-	ynabServer = flag.String("ynab-server", "https://api.ynab.com/v1/", "YNAB api server")
+	portFlag       = flag.Int("port", 8080, "Port for the HTTP server")
+	dbFileFlag     = flag.String("dbfile", "example.db", "SQLite database file")
+	ynabToken      = flag.String("ynab-token", os.Getenv("YNAB_TOKEN"), "YNAB access token, can specify with YNAB_TOKEN")
+	ynabServer     = flag.String("ynab-server", "https://api.ynab.com/v1/", "YNAB api server")
+	ynabMemo       = flag.String("ynab-memo", ynab.DefaultMemo, "template for the memo of YNAB transactions matched to an order, empty to leave memos alone")
+	keepMemo       = flag.Bool("ynab-keep-memo", false, "don't replace YNAB memos that are already filled in")
+	password       = flag.String("password", os.Getenv("UI_PASSWORD"), "password for the UI, can specify with UI_PASSWORD")
+	insecure       = flag.Bool("insecure", false, "allow running without a password, leaving the UI open to anyone who can reach it")
+	corsFlag       = flag.String("cors-origins", "https://www.amazon.com", "comma-separated origins allowed to call the API")
+	autoApprove    = flag.Float64("auto-approve", 0, "offer to approve YNAB transactions in one go when one order matches at least this well, like 0.9; 0 to always ask")
+	autoConfidence = flag.Float64("auto-approve-confidence", 0.8, "how sure a learned category has to be to auto-approve with it, when no rule picks one")
+	autoExamples   = flag.Int("auto-approve-examples", 50, "how many items have to have been learned before auto-approving with a learned category")
+	autoCategories = flag.Int("auto-approve-categories", 3, "how many categories have to have been learned before auto-approving with a learned category")
+	matchFlags     = match.DefaultConfig()
 )
 
+func init() {
+	flag.DurationVar(&matchFlags.Window, "match-window", matchFlags.Window, "how far apart an Amazon charge and YNAB transaction can be")
+	flag.Func("match-tolerance", "how far an Amazon charge's amount can be from the YNAB transaction's, like 0.05", func(s string) (err error) {
+		matchFlags.AmountTolerance, err = models.ParseMoney(s)
+		return err
+	})
+	flag.IntVar(&matchFlags.MaxGroup, "match-group", matchFlags.MaxGroup, "the most Amazon orders billed together to look for, 0 to only match single orders")
+	flag.Func("match-payee", "regular expression for YNAB payees that are Amazon (default \""+matchFlags.Payee.String()+"\")", func(s string) (err error) {
+		matchFlags.Payee, err = regexp.Compile(s)
+		return err
+	})
+}
+
 func main() {
 	// Parse command-line flags
 	flag.Parse()
@@ -32,21 +64,58 @@ func main() {
 	}
 	defer repo.Close()
 
+	switch cmd := flag.Arg(0); cmd {
+	case "":
+	case "reparse":
+		if err := reparse(repo); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "import-orders":
+		if err := importOrders(repo, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	default:
+		log.Fatalf("unknown command %q", cmd)
+	}
+
 	ynabRepo, err := ynab.New(ynab.Config{
-		Token:  *ynabToken,
-		Server: *ynabServer,
+		Token:    *ynabToken,
+		Server:   *ynabServer,
+		Memo:     *ynabMemo,
+		KeepMemo: *keepMemo,
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	u, err := ui.New(repo, ynabRepo)
-	if err != nil {
+	if *password == "" && *insecure {
+		log.Println("WARNING: no -password set, anyone who can reach this server can use the UI")
+	}
+	u, err := ui.New(repo, ynabRepo, ui.Config{
+		Password: *password,
+		Insecure: *insecure,
+		Match:    matchFlags,
+		AutoApprove: autoapprove.Config{
+			MinScore:      *autoApprove,
+			MinConfidence: *autoConfidence,
+			MinExamples:   *autoExamples,
+			MinCategories: *autoCategories,
+		},
+	})
+	if errors.Is(err, ui.ErrNoPassword) {
+		log.Fatal("set -password or UI_PASSWORD, or -insecure to run without one")
+	} else if err != nil {
 		log.Fatal(err)
 	}
 
+	apiHandler := api.New(repo, api.Config{
+		AllowedOrigins: strings.Split(*corsFlag, ","),
+	})
+
 	mux := http.NewServeMux()
-	mux.Handle("/api/", http.StripPrefix("/api", api.New(repo)))
+	mux.Handle("/api/", http.StripPrefix("/api", apiHandler))
 	mux.Handle("/", u)
 
 	// Start the server
@@ -55,6 +124,54 @@ func main() {
 	log.Fatal(http.ListenAndServe(addr, withLog(mux)))
 }
 
+// importOrders loads Retail.OrderHistory CSV files from Amazon's data export
+func importOrders(repo *store.Store, files []string) error {
+	if len(files) == 0 {
+		return fmt.Errorf("usage: import-orders Retail.OrderHistory.1.csv...")
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		results, err := orderhistory.Import(context.Background(), repo, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		printResults(results)
+		log.Printf("imported %d orders from %s", len(results), name)
+	}
+	return nil
+}
+
+// reparse runs the current invoice parsers over the saved invoice pages
+func reparse(repo *store.Store) error {
+	results, err := invoice.Reparse(context.Background(), repo)
+	if err != nil {
+		return err
+	}
+	failed := printResults(results)
+	log.Printf("reparsed %d invoices, %d failed", len(results), failed)
+	return nil
+}
+
+// printResults writes a line per order, returning how many failed
+func printResults(results []models.SaveResult) (failed int) {
+	for _, res := range results {
+		switch {
+		case res.Err != nil:
+			failed++
+			fmt.Printf("%s\terror\t%v\n", res.ID, res.Err)
+		case res.Created:
+			fmt.Printf("%s\tcreated\n", res.ID)
+		default:
+			fmt.Printf("%s\tupdated\n", res.ID)
+		}
+	}
+	return failed
+}
+
 func withLog(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("http %s %s", r.Method, r.URL.Path)